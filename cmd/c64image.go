@@ -1,45 +1,129 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"flag"
 	"github.com/lastsys/c64image/internal/c64image"
-	"image"
 	"io/ioutil"
 	"log"
+	"os"
 	"strings"
 )
 
 func main() {
-	files, err := ioutil.ReadDir("./")
-	if err != nil {
-		panic(err)
-	}
+	configFile := flag.String("config", "", "read conversion options from a JSON file")
+	method := flag.String("method", "", "only convert with this method (RGB, CIE76, CIE94, CIE2000 or CAM16UCS), or auto to choose one per image")
+	dither := flag.String("dither", "None", "dither mode (None, FloydSteinberg, Bayer or BlueNoise)")
+	chromaDither := flag.Bool("chromadither", false, "with FloydSteinberg, only diffuse color error and keep lightness clean")
+	minContrast := flag.Float64("mincontrast", 0, "minimum delta-E between adjacent regions")
+	coherence := flag.Float64("coherence", 0, "penalty for differing from neighboring colors")
+	autoLevels := flag.Bool("autolevels", false, "stretch every channel to the full range before converting")
+	autoLevelsClip := flag.Float64("autolevelsclip", 0, "fraction of darkest and brightest values ignored by -autolevels")
+	clampChroma := flag.Bool("clampchroma", false, "reduce colors more saturated than the palette can reach before matching")
+	trim := flag.Bool("trim", false, "remove dark bars from the edges of the source")
+	maxAspect := flag.Float64("maxaspect", 0, "crop sources whose long side exceeds this many times the short side")
+	filter := flag.String("filter", "Box", "how the source is reduced to the C64 grid (Box or Lanczos)")
+	overlap := flag.Float64("overlap", 0, "average each block over this many times its size (supersampling)")
+	jitter := flag.Float64("jitter", 0, "shift every block by up to half this fraction of its size to break up banding")
+	jitterSeed := flag.Int64("jitterseed", 0, "seed for the -jitter pattern")
+	lightness := flag.Float64("lightness", 0, "weight of lightness differences for CIE94 and CIE2000 (0 for 1)")
+	chroma := flag.Float64("chroma", 0, "weight of chroma differences for CIE94 and CIE2000 (0 for 1)")
+	brightness := flag.Float64("brightness", 0, "keep the mean lightness of the result within this many CIELAB units of the source")
+	extended := flag.Bool("extended", false, "match 2x2 groups against checkerboard mixes of two palette colors")
+	maxColors := flag.Int("maxcolors", 0, "limit each image to this many palette colors (0 for all)")
+	dedup := flag.Bool("dedup", false, "convert files with identical pixel content only once")
+	preview := flag.Bool("preview", false, "print converted images to the terminal")
+	debugDir := flag.String("debug", "", "write intermediate images of every conversion to this directory")
+	timing := flag.Bool("timing", false, "log how long each conversion phase took")
+	warn := flag.Bool("warn", false, "log advice when an image is likely to lose detail")
+	workers := flag.Int("workers", 0, "number of files converted at once (0 for one per CPU)")
+	flag.Parse()
 
-	rgbChannel := make(chan *image.RGBA)
-	cie76Channel := make(chan *image.RGBA)
-	cie94Channel := make(chan *image.RGBA)
-	cie2000Channel := make(chan *image.RGBA)
+	opts := c64image.DirOptions{Dedup: *dedup, Timing: *timing, Warn: *warn, Workers: *workers}
+	if *preview {
+		opts.Preview = os.Stdout
+	}
 
-	for _, f := range files {
+	if *configFile != "" {
+		config, err := ioutil.ReadFile(*configFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts.Options, err = c64image.ReadConfig(bytes.NewReader(config), opts.Options)
+		if err != nil {
+			log.Fatalf("%v: %v", *configFile, err)
+		}
+		// A method in the config restricts conversion to it, like -method.
+		var probe struct {
+			Method *string `json:"method"`
+		}
+		if err := json.Unmarshal(config, &probe); err != nil {
+			log.Fatalf("%v: %v", *configFile, err)
+		}
+		if probe.Method != nil {
+			opts.Methods = []c64image.Method{opts.Options.Method}
+		}
+	}
 
-		if strings.HasSuffix(f.Name(), ".jpg") {
-			originalImage, err := c64image.LoadImage(f.Name())
-			if err != nil {
-				panic(err)
+	// Flags given on the command line override the config.
+	var err error
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "method":
+			if strings.EqualFold(*method, "auto") {
+				opts.AutoMethod = true
+				break
 			}
-			baseFilename := strings.TrimSuffix(f.Name(), ".jpg")
-			log.Printf("Processing %v\n", baseFilename)
-			go c64image.ConvertImage(originalImage, c64image.RGBMethod, rgbChannel)
-			go c64image.ConvertImage(originalImage, c64image.CIE76, cie76Channel)
-			go c64image.ConvertImage(originalImage, c64image.CIE94, cie94Channel)
-			go c64image.ConvertImage(originalImage, c64image.CIE2000, cie2000Channel)
-
-			log.Print("Saving\n")
-			c64image.SaveImage(<-rgbChannel, "c64_"+baseFilename+"_RGB.png")
-			c64image.SaveImage(<-cie76Channel, "c64_"+baseFilename+"_CIE76.png")
-			c64image.SaveImage(<-cie94Channel, "c64_"+baseFilename+"_CIE94.png")
-			c64image.SaveImage(<-cie2000Channel, "c64_"+baseFilename+"_CIE2000.png")
-			log.Print("Done.\n")
-			log.Print("-----------------------------\n")
+			var m c64image.Method
+			m, err = c64image.ParseMethod(*method)
+			opts.Methods = []c64image.Method{m}
+		case "dither":
+			opts.Options.Dither, err = c64image.ParseDither(*dither)
+		case "chromadither":
+			opts.Options.ChromaOnlyDither = *chromaDither
+		case "mincontrast":
+			opts.Options.MinContrast = *minContrast
+		case "coherence":
+			opts.Options.Coherence = *coherence
+		case "autolevels":
+			opts.Options.AutoLevels = *autoLevels
+		case "autolevelsclip":
+			opts.Options.AutoLevelsClip = *autoLevelsClip
+		case "clampchroma":
+			opts.Options.ClampChroma = *clampChroma
+		case "trim":
+			opts.Options.TrimBars = *trim
+		case "maxaspect":
+			opts.Options.MaxAspectRatio = *maxAspect
+		case "filter":
+			opts.Options.DownscaleFilter, err = c64image.ParseDownscaleFilter(*filter)
+		case "overlap":
+			opts.Options.BlockOverlap = *overlap
+		case "jitter":
+			opts.Options.SamplingJitter = *jitter
+		case "jitterseed":
+			opts.Options.JitterSeed = *jitterSeed
+		case "lightness":
+			opts.Options.LightnessWeight = *lightness
+		case "chroma":
+			opts.Options.ChromaWeight = *chroma
+		case "brightness":
+			opts.Options.PreserveBrightness = *brightness
+		case "extended":
+			opts.Options.ExtendedPalette = *extended
+		case "debug":
+			opts.Options.DebugDir = *debugDir
+		case "maxcolors":
+			opts.Options.MaxScreenColors = *maxColors
+		}
+		if err != nil {
+			log.Fatal(err)
 		}
+	})
+
+	err = c64image.ConvertDir("./", opts)
+	if err != nil {
+		panic(err)
 	}
 }
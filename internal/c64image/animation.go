@@ -0,0 +1,127 @@
+package c64image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"io/ioutil"
+)
+
+// AnimatedImageError is returned by LoadImageWithOptions for files with more
+// than one frame when LoadOptions.FirstFrameOnly is false.
+var AnimatedImageError = fmt.Errorf("image has several frames, use LoadGIF and ConvertGIF")
+
+// LoadOptions controls LoadImageWithOptions.
+type LoadOptions struct {
+	// FirstFrameOnly loads the first frame of animated GIF and APNG files.
+	// When false such files are rejected with AnimatedImageError instead of
+	// being silently cut to one frame.
+	FirstFrameOnly bool
+}
+
+// DefaultLoadOptions are used by LoadImage.
+var DefaultLoadOptions = LoadOptions{FirstFrameOnly: true}
+
+// LoadImageWithOptions loads filename like LoadImage.
+func LoadImageWithOptions(filename string, opts LoadOptions) (*image.RGBA, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if !opts.FirstFrameOnly {
+		frames, err := frameCount(data)
+		if err != nil {
+			return nil, err
+		}
+		if frames > 1 {
+			return nil, fmt.Errorf("%w: %v has %d frames", AnimatedImageError, filename, frames)
+		}
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return toRGBA(img)
+}
+
+// Number of frames in an encoded GIF or APNG. Other formats have one.
+func frameCount(data []byte) (int, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("GIF8")):
+		g, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return 0, err
+		}
+		return len(g.Image), nil
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		// The acTL chunk of an APNG holds the frame count and must come
+		// before the image data.
+		for p := 8; p+12 <= len(data); {
+			length := int(binary.BigEndian.Uint32(data[p:]))
+			chunk := string(data[p+4 : p+8])
+			if chunk == "IDAT" {
+				break
+			}
+			if chunk == "acTL" && length >= 8 && p+16 <= len(data) {
+				return int(binary.BigEndian.Uint32(data[p+8:])), nil
+			}
+			p += length + 12
+		}
+	}
+	return 1, nil
+}
+
+// LoadGIF loads every frame of a GIF file.
+func LoadGIF(filename string) (*gif.GIF, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return gif.DecodeAll(bytes.NewReader(data))
+}
+
+// ConvertGIF converts every frame of g as it is shown, drawn over the
+// previous frames according to their disposal methods. Static areas are kept
+// stable between frames as set by opts.TemporalTolerance.
+func ConvertGIF(g *gif.GIF, opts ConvertOptions) ([]*image.RGBA, error) {
+	if len(g.Image) == 0 {
+		return nil, EmptyImageError
+	}
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	if bounds.Empty() {
+		bounds = g.Image[0].Bounds()
+	}
+	canvas := image.NewRGBA(bounds)
+	converter := Converter{Options: opts}
+
+	results := make([]*image.RGBA, len(g.Image))
+	for i, frame := range g.Image {
+		var disposal byte
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		var previous *image.RGBA
+		if disposal == gif.DisposalPrevious {
+			previous = image.NewRGBA(bounds)
+			copy(previous.Pix, canvas.Pix)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		result, err := converter.ConvertFrame(canvas)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = result
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			copy(canvas.Pix, previous.Pix)
+		}
+	}
+	return results, nil
+}
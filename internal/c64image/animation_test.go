@@ -0,0 +1,62 @@
+package c64image
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadAnimatedGIF(t *testing.T) {
+	palette := color.Palette{C64Colors[0], C64Colors[1], C64Colors[2]}
+	g := &gif.GIF{}
+	for _, index := range []uint8{1, 2} {
+		frame := image.NewPaletted(image.Rect(0, 0, 640, 400), palette)
+		for i := range frame.Pix {
+			frame.Pix[i] = index
+		}
+		g.Image = append(g.Image, frame)
+		g.Delay = append(g.Delay, 10)
+	}
+	filename := filepath.Join(t.TempDir(), "animated.gif")
+	file, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gif.EncodeAll(file, g); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	img, err := LoadImage(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := Convert(img, ConvertOptions{Method: CIE2000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := out.RGBAAt(10, 10); c != C64Colors[1] {
+		t.Errorf("first frame converted to %v, want white", c)
+	}
+
+	_, err = LoadImageWithOptions(filename, LoadOptions{FirstFrameOnly: false})
+	if !errors.Is(err, AnimatedImageError) {
+		t.Errorf("got %v, want AnimatedImageError", err)
+	}
+
+	loaded, err := LoadGIF(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames, err := ConvertGIF(loaded, ConvertOptions{Method: CIE2000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 2 || frames[1].RGBAAt(10, 10) != C64Colors[2] {
+		t.Errorf("ConvertGIF did not convert every frame")
+	}
+}
@@ -0,0 +1,38 @@
+package c64image
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"io"
+)
+
+// Maximum number of text columns written by RenderANSI.
+const ANSIColumns = 80
+
+// RenderANSI writes img to w as text using 24-bit ANSI colors. Every
+// character is an upper half block with the top pixel as foreground and the
+// bottom pixel as background, so each text line holds two image rows. The
+// image is downsampled to at most ANSIColumns columns.
+func RenderANSI(img *image.RGBA, w io.Writer) error {
+	size := img.Rect.Size()
+	step := (size.X + ANSIColumns - 1) / ANSIColumns
+	if step < 1 {
+		step = 1
+	}
+
+	out := bufio.NewWriter(w)
+	for y := 0; y < size.Y; y += 2 * step {
+		for x := 0; x < size.X; x += step {
+			top := img.RGBAAt(img.Rect.Min.X+x, img.Rect.Min.Y+y)
+			bottom := top
+			if y+step < size.Y {
+				bottom = img.RGBAAt(img.Rect.Min.X+x, img.Rect.Min.Y+y+step)
+			}
+			fmt.Fprintf(out, "\x1b[38;2;%d;%d;%dm\x1b[48;2;%d;%d;%dm▀",
+				top.R, top.G, top.B, bottom.R, bottom.G, bottom.B)
+		}
+		out.WriteString("\x1b[0m\n")
+	}
+	return out.Flush()
+}
@@ -0,0 +1,34 @@
+package c64image
+
+import (
+	"bytes"
+	"image"
+	"strings"
+	"testing"
+)
+
+func TestRenderANSI(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, C64Width, C64Height))
+	for x := 0; x < C64Width; x++ {
+		img.SetRGBA(x, 0, C64Colors[2])
+	}
+
+	var buf bytes.Buffer
+	if err := RenderANSI(img, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 25 {
+		t.Errorf("expected 25 rows, got %v", len(lines))
+	}
+	if !strings.HasPrefix(lines[0], "\x1b[38;2;103;55;43m\x1b[48;2;0;0;0m▀") {
+		t.Errorf("first row does not start with red over black: %q", lines[0][:40])
+	}
+	if n := strings.Count(lines[1], "▀"); n != ANSIColumns {
+		t.Errorf("expected %v columns, got %v", ANSIColumns, n)
+	}
+	if !strings.HasSuffix(lines[1], "\x1b[0m") {
+		t.Errorf("row does not reset attributes")
+	}
+}
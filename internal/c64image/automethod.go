@@ -0,0 +1,86 @@
+package c64image
+
+import (
+	"image"
+	"math"
+)
+
+// Methods tried by ConvertAutoMethod, in order of preference on equal scores.
+var autoMethods = []Method{RGBMethod, CIE76, CIE94, CIE2000, CAM16UCS}
+
+// Radius in blocks of the box that source and result are blurred with before
+// ConvertAutoMethod compares them.
+const autoMethodBlur = 1
+
+// ConvertAutoMethod converts img like ConvertFull with the method whose
+// result looks closest to the source, ignoring opts.Method. Result.Method
+// is the method it chose. The source is sampled into blocks once, and every
+// method matches the same blocks with the dither and passes of opts.
+// Results are scored by perceivedError, so choosing costs only the matching
+// per method, not a full conversion. The metrics are those of the chosen
+// method.
+func ConvertAutoMethod(img *image.RGBA, opts ConvertOptions) (*Result, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	var sampled Metrics
+	sampling := opts
+	sampling.autoMethod = true
+	grid, err := sampleSource(img, sampling, &sampled)
+	if err != nil {
+		return nil, err
+	}
+
+	var result *Result
+	var best []uint8
+	bestScore := math.Inf(1)
+	for _, method := range autoMethods {
+		metrics := sampled
+		indices, err := matchGrid(grid, opts.withMethod(method), &metrics)
+		if err != nil {
+			return nil, err
+		}
+		if score := perceivedError(grid, indices); score < bestScore {
+			result = &Result{Method: method, Metrics: metrics}
+			best, bestScore = indices, score
+		}
+	}
+	result.render(grid, best)
+	result.Warnings = Warnings(img)
+	return result, nil
+}
+
+// Mean CIE2000 delta-E between the blocks and the palette colors of indices
+// after blurring both in linear light, roughly as seen from a distance. No
+// method minimizes this block by block, and dithering counts by how well it
+// averages out.
+func perceivedError(grid blockGrid, indices []uint8) float64 {
+	source := make([]xyz, len(indices))
+	result := make([]xyz, len(indices))
+	for p, index := range indices {
+		source[p] = convertRGBAtoXYZ(grid.rgb[p])
+		result[p] = convertRGBAtoXYZ(C64Colors[index])
+	}
+	blur := func(c []xyz, i, j int) cielab {
+		var sum xyz
+		n := 0.
+		for y := j - autoMethodBlur; y <= j+autoMethodBlur; y++ {
+			for x := i - autoMethodBlur; x <= i+autoMethodBlur; x++ {
+				if x >= 0 && x < grid.width && y >= 0 && y < grid.height {
+					v := c[y*grid.width+x]
+					sum.x, sum.y, sum.z = sum.x+v.x, sum.y+v.y, sum.z+v.z
+					n++
+				}
+			}
+		}
+		return convertRGBAtoCIELAB(convertXYZtoRGBA(xyz{sum.x / n, sum.y / n, sum.z / n}))
+	}
+
+	score := 0.
+	for j := 0; j < grid.height; j++ {
+		for i := 0; i < grid.width; i++ {
+			score += math.Sqrt(cie2000distance(blur(source, i, j), blur(result, i, j)))
+		}
+	}
+	return score / float64(len(indices))
+}
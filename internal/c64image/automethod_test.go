@@ -0,0 +1,95 @@
+package c64image
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConvertAutoMethod(t *testing.T) {
+	gray := image.NewRGBA(image.Rect(0, 0, 640, 400))
+	for y := 0; y < 400; y++ {
+		for x := 0; x < 640; x++ {
+			v := uint8(x * 255 / 640)
+			gray.SetRGBA(x, y, color.RGBA{v, v, v, 0xFF})
+		}
+	}
+	saturated := image.NewRGBA(image.Rect(0, 0, 640, 400))
+	for y := 0; y < 400; y++ {
+		for x := 0; x < 640; x++ {
+			saturated.SetRGBA(x, y, color.RGBA{uint8(x * 255 / 640), 0x00, uint8(0xFF - y*255/400), 0xFF})
+		}
+	}
+
+	for _, test := range []struct {
+		name   string
+		img    *image.RGBA
+		dither Dither
+		want   Method
+	}{
+		// RGB puts the thresholds between the grays in gamma space, too
+		// dark, while CIE76 and CIE94 coincide for neutral colors.
+		{"gray", gray, NoDither, CIE2000},
+		{"gray", gray, Bayer, CIE76},
+		{"saturated", saturated, NoDither, CIE2000},
+		{"saturated", saturated, FloydSteinberg, CIE76},
+	} {
+		opts := ConvertOptions{Dither: test.dither}
+		result, err := ConvertAutoMethod(test.img, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Method != test.want {
+			t.Errorf("%v with %v: chose %v, want %v", test.name, test.dither, result.Method, test.want)
+		}
+		used, err := ConvertFull(test.img, opts.withMethod(result.Method))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(result.Image.Pix, used.Image.Pix) || !bytes.Equal(result.Indices, used.Indices) || result.Width != used.Width {
+			t.Errorf("%v with %v: output does not match the reported method %v", test.name, test.dither, result.Method)
+		}
+		if result.Metrics.Sample <= 0 || result.Metrics.Match <= 0 || result.Metrics.Render <= 0 {
+			t.Errorf("%v with %v: metrics %+v", test.name, test.dither, result.Metrics)
+		}
+	}
+}
+
+func TestPerceivedError(t *testing.T) {
+	// Alternating black and white blocks look like the gray between them.
+	grid := sampleBlocks(image.NewRGBA(image.Rect(0, 0, 320, 200)), sampling{})
+	white := convertRGBAtoXYZ(C64Colors[1])
+	checker := make([]uint8, len(grid.lab))
+	for p := range checker {
+		if (p%grid.width+p/grid.width)%2 == 0 {
+			checker[p] = 1
+		}
+		grid.rgb[p] = convertXYZtoRGBA(xyz{white.x / 2., white.y / 2., white.z / 2.})
+	}
+	solid := make([]uint8, len(grid.lab))
+	if checkered, black := perceivedError(grid, checker), perceivedError(grid, solid); checkered > 5 || black < 50 {
+		t.Errorf("got %v for a checkerboard and %v for black", checkered, black)
+	}
+}
+
+func TestConvertAutoMethodDebugDir(t *testing.T) {
+	dir := t.TempDir()
+	result, err := ConvertAutoMethod(gradientImage(320, 200), ConvertOptions{Method: RGBMethod, DebugDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{"auto_source.png", "auto_blocks.png", result.Method.String() + "_result.png"}
+	for _, name := range names {
+		if _, err := LoadImage(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%v: %v", name, err)
+		}
+	}
+	for _, name := range []string{"RGB_source.png", "RGB_blocks.png"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			t.Errorf("%v named after the unused opts.Method", name)
+		}
+	}
+}
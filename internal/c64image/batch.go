@@ -0,0 +1,284 @@
+package c64image
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"image"
+	"io"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Methods used by ConvertDir unless DirOptions.Methods is set.
+var dirMethods = []Method{RGBMethod, CIE76, CIE94, CIE2000, CAM16UCS}
+
+// DirOptions controls ConvertDir.
+type DirOptions struct {
+	// Options used for every conversion. The method is taken from Methods.
+	Options ConvertOptions
+
+	// Methods to convert every file with, in output order. Nil uses all.
+	Methods []Method
+
+	// Dedup converts files with identical decoded pixels only once and
+	// writes the shared result under each file name.
+	Dedup bool
+
+	// Preview, if set, receives every result rendered with RenderANSI.
+	Preview io.Writer
+
+	// Timing logs how long every phase took for each file and method.
+	Timing bool
+
+	// Warn logs the advice from Warnings for every file.
+	Warn bool
+
+	// Workers is the number of files decoded and converted at once. Zero
+	// uses runtime.NumCPU().
+	Workers int
+
+	// AutoMethod converts every file only with the method chosen by
+	// ConvertAutoMethod instead of with Methods, and saves it under the
+	// name of that method.
+	AutoMethod bool
+}
+
+// Called once for every image actually converted by ConvertDir.
+var testHookConvert func()
+
+// Called by ConvertDir after decoding a file with the number of decoded
+// images in memory.
+var testHookDecoded func(inFlight int32)
+
+// ConvertDir converts all .jpg files in dir with every method in
+// opts.Methods and saves the results as c64_<name>_<method>.png in the same
+// directory. Up to opts.Workers files are processed at once.
+func ConvertDir(dir string, opts DirOptions) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	b := &dirBatch{
+		dir:       dir,
+		opts:      opts,
+		methods:   opts.Methods,
+		converted: make(map[[sha256.Size]byte]*dedupEntry),
+	}
+	if b.methods == nil {
+		b.methods = dirMethods
+	}
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	// Every worker holds at most one decoded file, so the number of workers
+	// bounds the memory in use and not just the number of conversions.
+	names := make(chan string)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range names {
+				if err := b.convertFile(name); err != nil {
+					b.fail(err)
+				}
+			}
+		}()
+	}
+	for _, f := range files {
+		if !strings.HasSuffix(f.Name(), ".jpg") {
+			continue
+		}
+		if b.failed() != nil {
+			break
+		}
+		names <- f.Name()
+	}
+	close(names)
+	wg.Wait()
+	return b.failed()
+}
+
+// State shared by the workers of ConvertDir.
+type dirBatch struct {
+	dir     string
+	opts    DirOptions
+	methods []Method
+
+	inFlight int32 // decoded images, updated atomically
+
+	mu        sync.Mutex
+	converted map[[sha256.Size]byte]*dedupEntry
+	err       error
+	preview   sync.Mutex // keeps the previews of one file together
+}
+
+// Results for one pixelHash, ready once done is closed.
+type dedupEntry struct {
+	done    chan struct{}
+	methods []Method
+	results []*image.RGBA
+	err     error
+}
+
+// Record the first error of any worker.
+func (b *dirBatch) fail(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+func (b *dirBatch) failed() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.err
+}
+
+// Load, convert and save one file.
+func (b *dirBatch) convertFile(name string) error {
+	opts := b.opts
+	start := time.Now()
+	originalImage, err := LoadImage(filepath.Join(b.dir, name))
+	if err != nil {
+		return err
+	}
+	decode := time.Since(start)
+	inFlight := atomic.AddInt32(&b.inFlight, 1)
+	defer atomic.AddInt32(&b.inFlight, -1)
+	if testHookDecoded != nil {
+		testHookDecoded(inFlight)
+	}
+	if opts.Warn {
+		for _, warning := range Warnings(originalImage) {
+			log.Printf("Warning: %v\n", warning)
+		}
+	}
+	baseFilename := strings.TrimSuffix(name, ".jpg")
+	log.Printf("Processing %v\n", baseFilename)
+
+	opts.Options.debugName = baseFilename
+	var methods []Method
+	var results []*image.RGBA
+	var metrics []Metrics
+	if opts.Dedup {
+		// The first file with these pixels converts them, later ones wait
+		// for its results.
+		key := pixelHash(originalImage)
+		b.mu.Lock()
+		entry, found := b.converted[key]
+		if !found {
+			entry = &dedupEntry{done: make(chan struct{})}
+			b.converted[key] = entry
+		}
+		b.mu.Unlock()
+		if found {
+			<-entry.done
+			if entry.err != nil {
+				return entry.err
+			}
+			log.Printf("%v is identical to an earlier image, reusing result\n", baseFilename)
+			methods, results, metrics = entry.methods, entry.results, make([]Metrics, len(entry.methods))
+		} else {
+			methods, results, metrics, err = b.convert(originalImage, opts.Options)
+			entry.methods, entry.results, entry.err = methods, results, err
+			close(entry.done)
+		}
+	} else {
+		methods, results, metrics, err = b.convert(originalImage, opts.Options)
+	}
+	if err != nil {
+		return err
+	}
+	if b.opts.AutoMethod {
+		log.Printf("%v converts best with %v\n", baseFilename, methods[0])
+	}
+
+	log.Printf("Saving %v\n", baseFilename)
+	for i, method := range methods {
+		filename := filepath.Join(b.dir, "c64_"+baseFilename+"_"+method.String()+".png")
+		start := time.Now()
+		if err := SaveImage(results[i], filename); err != nil {
+			return err
+		}
+		if opts.Timing {
+			metrics[i].Decode = decode
+			metrics[i].Encode = time.Since(start)
+			log.Printf("%v %v timing: %v\n", baseFilename, method, metrics[i])
+		}
+	}
+	if opts.Preview != nil {
+		b.preview.Lock()
+		defer b.preview.Unlock()
+		for i, method := range methods {
+			log.Printf("%v %v:\n", baseFilename, method)
+			if err := RenderANSI(results[i], opts.Preview); err != nil {
+				return err
+			}
+		}
+	}
+	log.Printf("Done with %v.\n", baseFilename)
+	return nil
+}
+
+// Convert img with the methods of the batch, or the one ConvertAutoMethod
+// chooses, and return them with the results.
+func (b *dirBatch) convert(img *image.RGBA, opts ConvertOptions) ([]Method, []*image.RGBA, []Metrics, error) {
+	if testHookConvert != nil {
+		testHookConvert()
+	}
+	if b.opts.AutoMethod {
+		result, err := ConvertAutoMethod(img, opts)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return []Method{result.Method}, []*image.RGBA{result.Image}, []Metrics{result.Metrics}, nil
+	}
+	results, metrics, err := convertAllMethods(img, b.methods, opts)
+	return b.methods, results, metrics, err
+}
+
+// Convert image with every method concurrently.
+func convertAllMethods(img *image.RGBA, methods []Method, opts ConvertOptions) ([]*image.RGBA, []Metrics, error) {
+	results := make([]*image.RGBA, len(methods))
+	metrics := make([]Metrics, len(methods))
+	errs := make([]error, len(methods))
+	var wg sync.WaitGroup
+	for i, method := range methods {
+		wg.Add(1)
+		go func(i int, opts ConvertOptions) {
+			defer wg.Done()
+			results[i], metrics[i], errs[i] = ConvertWithMetrics(img, opts)
+		}(i, opts.withMethod(method))
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return results, metrics, nil
+}
+
+// Hash decoded pixels so that re-encoded duplicates are detected as well.
+func pixelHash(img *image.RGBA) [sha256.Size]byte {
+	h := sha256.New()
+	size := img.Rect.Size()
+	binary.Write(h, binary.LittleEndian, [2]int64{int64(size.X), int64(size.Y)})
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		offset := img.PixOffset(img.Rect.Min.X, y)
+		h.Write(img.Pix[offset : offset+size.X*4])
+	}
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
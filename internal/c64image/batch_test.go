@@ -0,0 +1,116 @@
+package c64image
+
+import (
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func writeJPEG(t *testing.T, img image.Image, filename string) {
+	file, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := jpeg.Encode(file, img, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConvertDirDedup(t *testing.T) {
+	dir := t.TempDir()
+	img := image.NewRGBA(image.Rect(0, 0, 640, 400))
+	for y := 0; y < 400; y++ {
+		for x := 0; x < 640; x++ {
+			img.SetRGBA(x, y, color.RGBA{uint8(x / 3), uint8(y / 2), 100, 255})
+		}
+	}
+	writeJPEG(t, img, filepath.Join(dir, "a.jpg"))
+	writeJPEG(t, img, filepath.Join(dir, "b.jpg"))
+
+	var conversions int32
+	testHookConvert = func() { atomic.AddInt32(&conversions, 1) }
+	defer func() { testHookConvert = nil }()
+
+	if err := ConvertDir(dir, DirOptions{Dedup: true}); err != nil {
+		t.Fatal(err)
+	}
+	if conversions != 1 {
+		t.Errorf("expected 1 conversion, got %v", conversions)
+	}
+	for _, name := range []string{"a", "b"} {
+		for _, method := range dirMethods {
+			filename := filepath.Join(dir, "c64_"+name+"_"+method.String()+".png")
+			if _, err := os.Stat(filename); err != nil {
+				t.Errorf("missing output %v", filename)
+			}
+		}
+	}
+
+	conversions = 0
+	if err := ConvertDir(dir, DirOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if conversions != 2 {
+		t.Errorf("expected 2 conversions without dedup, got %v", conversions)
+	}
+}
+
+func TestConvertDirWorkers(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a", "b", "c", "d"} {
+		writeJPEG(t, gradientImage(320, 200), filepath.Join(dir, name+".jpg"))
+	}
+	defer func() { testHookDecoded = nil }()
+
+	for _, workers := range []int{1, 3} {
+		var files, most int32
+		testHookDecoded = func(inFlight int32) {
+			atomic.AddInt32(&files, 1)
+			for {
+				m := atomic.LoadInt32(&most)
+				if inFlight <= m || atomic.CompareAndSwapInt32(&most, m, inFlight) {
+					break
+				}
+			}
+		}
+		opts := DirOptions{Methods: []Method{RGBMethod}, Workers: workers}
+		if err := ConvertDir(dir, opts); err != nil {
+			t.Fatal(err)
+		}
+		if files != 4 {
+			t.Errorf("%d workers: decoded %d files, want 4", workers, files)
+		}
+		if most > int32(workers) {
+			t.Errorf("%d workers: %d decoded images at once", workers, most)
+		}
+	}
+}
+
+func TestConvertDirAutoMethod(t *testing.T) {
+	dir := t.TempDir()
+	img := gradientImage(320, 200)
+	writeJPEG(t, img, filepath.Join(dir, "a.jpg"))
+	if err := ConvertDir(dir, DirOptions{AutoMethod: true}); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := LoadImage(filepath.Join(dir, "a.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ConvertAutoMethod(decoded, ConvertOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputs, err := filepath.Glob(filepath.Join(dir, "c64_a_*.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outputs) != 1 || filepath.Base(outputs[0]) != "c64_a_"+want.Method.String()+".png" {
+		t.Errorf("got %v, want only the %v result", outputs, want.Method)
+	}
+}
@@ -0,0 +1,38 @@
+package c64image
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"strings"
+)
+
+// Border sizes in pixels around the 320x200 screen as shown by common
+// emulators, giving a 384x272 PAL and a 384x240 NTSC frame.
+var borderSizes = map[string]image.Point{
+	"pal":  {32, 36},
+	"ntsc": {32, 20},
+}
+
+// AddBorder centers img in a frame filled with palette color
+// borderColorIndex. The mode "PAL" or "NTSC" (case insensitive) selects the
+// border size; an empty mode uses PAL. Images that are not 320x200, such as
+// aspect corrected ones, get the same border widths. It panics if
+// borderColorIndex is outside the palette or mode is unknown.
+func AddBorder(img *image.RGBA, borderColorIndex int, mode string) *image.RGBA {
+	if borderColorIndex < 0 || borderColorIndex >= len(C64Colors) {
+		panic(fmt.Sprintf("AddBorder: palette index %d", borderColorIndex))
+	}
+	if mode == "" {
+		mode = "pal"
+	}
+	border, ok := borderSizes[strings.ToLower(mode)]
+	if !ok {
+		panic(fmt.Sprintf("AddBorder: unknown mode %q", mode))
+	}
+	size := img.Rect.Size()
+	framed := image.NewRGBA(image.Rect(0, 0, size.X+2*border.X, size.Y+2*border.Y))
+	draw.Draw(framed, framed.Rect, image.NewUniform(C64Colors[borderColorIndex]), image.Point{}, draw.Src)
+	draw.Draw(framed, image.Rectangle{border, border.Add(size)}, img, img.Rect.Min, draw.Src)
+	return framed
+}
@@ -0,0 +1,62 @@
+package c64image
+
+import (
+	"image"
+	"testing"
+)
+
+func TestAddBorder(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, C64Width, C64Height))
+	fillImage(img, img.Rect, C64Colors[6])
+
+	for _, test := range []struct {
+		mode          string
+		width, height int
+	}{
+		{"PAL", 384, 272},
+		{"NTSC", 384, 240},
+	} {
+		framed := AddBorder(img, 14, test.mode)
+		if size := framed.Rect.Size(); size != image.Pt(test.width, test.height) {
+			t.Errorf("%v: got %v, want %vx%v", test.mode, size, test.width, test.height)
+			continue
+		}
+		left := (test.width - C64Width) / 2
+		top := (test.height - C64Height) / 2
+		for y := 0; y < test.height; y++ {
+			for x := 0; x < test.width; x++ {
+				want := C64Colors[14]
+				if x >= left && x < left+C64Width && y >= top && y < top+C64Height {
+					want = C64Colors[6]
+				}
+				if c := framed.RGBAAt(x, y); c != want {
+					t.Fatalf("%v: pixel (%v,%v) is %v, want %v", test.mode, x, y, c, want)
+				}
+			}
+		}
+	}
+}
+
+func TestAddBorderInvalid(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, C64Width, C64Height))
+	if framed := AddBorder(img, 0, ""); framed.Rect.Dy() != 272 {
+		t.Errorf("empty mode gives height %d, want PAL", framed.Rect.Dy())
+	}
+	for _, test := range []struct {
+		index int
+		mode  string
+	}{
+		{16, "PAL"},
+		{-1, "PAL"},
+		{0, "ntcs"},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("index %d, mode %q: no panic", test.index, test.mode)
+				}
+			}()
+			AddBorder(img, test.index, test.mode)
+		}()
+	}
+}
@@ -0,0 +1,76 @@
+package c64image
+
+import (
+	"math"
+	"sort"
+)
+
+// Recolor the blocks that are cheapest to change to a lighter or darker
+// palette color until the mean CIELAB lightness of the result is within
+// opts.PreserveBrightness of the mean of the blocks. Blocks snapped by
+// SnapPrimaries stay as they are.
+func preserveBrightness(grid blockGrid, indices []uint8, opts ConvertOptions, m matcher) {
+	var entry [len(C64Colors)]int
+	for i := range entry {
+		entry[i] = -1
+	}
+	for i, index := range m.indices {
+		entry[index] = i
+	}
+
+	deficit := 0.
+	for p, index := range indices {
+		if entry[index] >= 0 {
+			deficit += grid.lab[p].l - m.lab[entry[index]].l
+		}
+	}
+	allowed := opts.PreserveBrightness * float64(len(indices))
+	if math.Abs(deficit) <= allowed {
+		return
+	}
+	direction := math.Copysign(1, deficit)
+
+	// For every block the change towards the target lightness with the
+	// least added error per unit of lightness.
+	type change struct {
+		p          int
+		index      uint8
+		gain, cost float64
+	}
+	var changes []change
+	for p, index := range indices {
+		current := entry[index]
+		if current < 0 || snaps(grid.rgb[p], opts.SnapPrimaries, m) {
+			continue
+		}
+		currentDistance := math.Sqrt(m.distance(grid.lab[p], grid.rgb[p], current))
+		best := change{p: p, cost: math.Inf(1)}
+		for i := range m.indices {
+			gain := (m.lab[i].l - m.lab[current].l) * direction
+			if gain <= 0 {
+				continue
+			}
+			cost := (math.Sqrt(m.distance(grid.lab[p], grid.rgb[p], i)) - currentDistance) / gain
+			if cost < best.cost {
+				best = change{p, m.indices[i], gain, cost}
+			}
+		}
+		if best.gain > 0 {
+			changes = append(changes, best)
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].cost < changes[j].cost })
+
+	remaining := math.Abs(deficit)
+	for _, c := range changes {
+		if remaining <= allowed {
+			break
+		}
+		// Skip changes that would overshoot past the tolerance.
+		if c.gain > remaining+allowed {
+			continue
+		}
+		indices[c.p] = c.index
+		remaining -= c.gain
+	}
+}
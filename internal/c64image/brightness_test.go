@@ -0,0 +1,65 @@
+package c64image
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestPreserveBrightness(t *testing.T) {
+	meanLightness := func(img *image.RGBA) float64 {
+		sum := 0.
+		for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+			for x := img.Rect.Min.X; x < img.Rect.Max.X; x++ {
+				sum += convertRGBAtoCIELAB(img.RGBAAt(x, y)).l
+			}
+		}
+		return sum / float64(img.Rect.Dx()*img.Rect.Dy())
+	}
+	// Light gray between the palette grays, matched to the darker one.
+	img := image.NewRGBA(image.Rect(0, 0, 640, 400))
+	fillImage(img, img.Rect, color.RGBA{170, 170, 170, 0xFF})
+	source := meanLightness(img)
+
+	for _, dither := range []Dither{NoDither, FloydSteinberg} {
+		plain, err := Convert(img, ConvertOptions{Method: CIE2000, Dither: dither})
+		if err != nil {
+			t.Fatal(err)
+		}
+		preserved, err := Convert(img, ConvertOptions{Method: CIE2000, Dither: dither, PreserveBrightness: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		darkened := source - meanLightness(plain)
+		if dither == NoDither && darkened < 5 {
+			t.Fatalf("plain conversion only darkened by %v", darkened)
+		}
+		if d := math.Abs(source - meanLightness(preserved)); d > 1.01 {
+			t.Errorf("%v: mean lightness off by %v with PreserveBrightness 1, %v without", dither, d, darkened)
+		}
+	}
+}
+
+func TestPreserveBrightnessSnapUnavailable(t *testing.T) {
+	// White snaps to yellow, which the matcher doesn't have, so the blocks
+	// are not snapped and may be lightened from light gray to white.
+	white := image.NewRGBA(image.Rect(0, 0, 320, 200))
+	fillImage(white, white.Rect, color.RGBA{0xFF, 0xFF, 0xFF, 0xFF})
+	grid := sampleBlocks(white, sampling{})
+	indices := make([]uint8, len(grid.rgb))
+	for p := range indices {
+		indices[p] = 15
+	}
+	opts := ConvertOptions{PreserveBrightness: 1, SnapPrimaries: map[color.RGBA]uint8{{0xFF, 0xFF, 0xFF, 0xFF}: 7}}
+	preserveBrightness(grid, indices, opts, newMatcher(CIE2000, []uint8{0, 1, 11, 12, 15}))
+	lightened := 0
+	for _, index := range indices {
+		if index == 1 {
+			lightened++
+		}
+	}
+	if lightened == 0 {
+		t.Errorf("no block lightened")
+	}
+}
@@ -0,0 +1,116 @@
+package c64image
+
+import (
+	"image/color"
+	"math"
+)
+
+// Coordinates in CAM16-UCS: lightness J' and the opponent axes a', b'.
+type cam16ucs struct {
+	j, a, b float64
+}
+
+// CAM16 viewing conditions derived from the sRGB reference environment: the
+// sRGB white, adapting luminance 64/π·0.2 cd/m², background luminance factor
+// 20 and an average surround.
+var cam16 = newCAM16Conditions(convertRGBAtoXYZ(color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}), 64./math.Pi*.2, 20.)
+
+type cam16Conditions struct {
+	d       [3]float64 // per channel degree of adaptation factors
+	fl      float64    // luminance level adaptation factor
+	n, z    float64
+	nbb     float64
+	aw      float64 // achromatic response of white
+	c, nc   float64 // surround impact and chromatic induction
+	flRoot4 float64 // fl^0.25
+}
+
+// CAT16 matrix from XYZ to sharpened cone responses.
+var m16 = [3][3]float64{
+	{0.401288, 0.650173, -0.051461},
+	{-0.250268, 1.204414, 0.045854},
+	{-0.002079, 0.048952, 0.953127},
+}
+
+// Viewing conditions as defined by Li et al., "Comprehensive color solutions:
+// CAM16, CAT16, and CAM16-UCS", Color Research & Application 42(6), 2017.
+func newCAM16Conditions(white xyz, adaptingLuminance, backgroundLuminance float64) cam16Conditions {
+	const f, c, nc = 1., .69, 1. // average surround
+	la := adaptingLuminance
+	rgbw := m16Multiply(white)
+
+	var cond cam16Conditions
+	degree := f * (1. - 1./3.6*math.Exp((-la-42.)/92.))
+	degree = math.Max(0., math.Min(1., degree))
+	for i := range cond.d {
+		cond.d[i] = degree*white.y/rgbw[i] + 1. - degree
+	}
+
+	k := 1. / (5.*la + 1.)
+	k4 := k * k * k * k
+	cond.fl = .2*k4*5.*la + .1*(1.-k4)*(1.-k4)*math.Cbrt(5.*la)
+	cond.flRoot4 = math.Pow(cond.fl, .25)
+	cond.n = backgroundLuminance / white.y
+	cond.z = 1.48 + math.Sqrt(cond.n)
+	cond.nbb = .725 * math.Pow(cond.n, -.2)
+	cond.c, cond.nc = c, nc
+
+	adapted := cond.adapt(rgbw)
+	cond.aw = (2.*adapted[0] + adapted[1] + adapted[2]/20. - .305) * cond.nbb
+	return cond
+}
+
+func m16Multiply(c xyz) [3]float64 {
+	var rgb [3]float64
+	for i, row := range m16 {
+		rgb[i] = row[0]*c.x + row[1]*c.y + row[2]*c.z
+	}
+	return rgb
+}
+
+// Discount the illuminant and apply the post-adaptation compression.
+func (cond cam16Conditions) adapt(rgb [3]float64) [3]float64 {
+	var adapted [3]float64
+	for i, v := range rgb {
+		v *= cond.d[i]
+		x := math.Pow(cond.fl*math.Abs(v)/100., .42)
+		adapted[i] = math.Copysign(400.*x/(x+27.13), v) + .1
+	}
+	return adapted
+}
+
+func convertXYZtoCAM16UCS(c xyz) cam16ucs {
+	cond := cam16
+	ra := cond.adapt(m16Multiply(c))
+
+	a := ra[0] - 12.*ra[1]/11. + ra[2]/11.
+	b := (ra[0] + ra[1] - 2.*ra[2]) / 9.
+	h := math.Atan2(b, a)
+
+	achromatic := (2.*ra[0] + ra[1] + .05*ra[2] - .305) * cond.nbb
+	j := 0.
+	if achromatic > 0 {
+		j = 100. * math.Pow(achromatic/cond.aw, cond.c*cond.z)
+	}
+
+	et := .25 * (math.Cos(h+2.) + 3.8)
+	t := 50000. / 13. * cond.nc * cond.nbb * et * math.Hypot(a, b) / (ra[0] + ra[1] + 21./20.*ra[2])
+	chroma := math.Pow(t, .9) * math.Sqrt(j/100.) * math.Pow(1.64-math.Pow(.29, cond.n), .73)
+	colorfulness := chroma * cond.flRoot4
+
+	mPrime := math.Log(1.+.0228*colorfulness) / .0228
+	return cam16ucs{
+		j: 1.7 * j / (1. + .007*j),
+		a: mPrime * math.Cos(h),
+		b: mPrime * math.Sin(h),
+	}
+}
+
+func convertCIELABtoCAM16UCS(lab cielab) cam16ucs {
+	return convertXYZtoCAM16UCS(convertCIELABtoXYZ(lab))
+}
+
+// Squared Euclidean distance, like the other distance functions.
+func cam16ucsDistance(c1, c2 cam16ucs) float64 {
+	return (c1.j-c2.j)*(c1.j-c2.j) + (c1.a-c2.a)*(c1.a-c2.a) + (c1.b-c2.b)*(c1.b-c2.b)
+}
@@ -0,0 +1,42 @@
+package c64image
+
+import (
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestCAM16UCS(t *testing.T) {
+	lightness := func(v uint8) float64 {
+		return convertXYZtoCAM16UCS(convertRGBAtoXYZ(color.RGBA{v, v, v, 0xFF})).j
+	}
+	white, gray, black := lightness(0xFF), lightness(0x80), lightness(0)
+	if math.Abs(white-100.) > 1e-6 {
+		t.Errorf("white has J' %v, want 100", white)
+	}
+	if !(white > gray && gray > black && black >= 0) {
+		t.Errorf("lightness out of order: white %v, gray %v, black %v", white, gray, black)
+	}
+
+	for i, c := range C64Colors {
+		if got := closestC64Color(convertRGBAtoCIELAB(c), c, CAM16UCS); got != i {
+			t.Errorf("palette color %v matched %v", i, got)
+		}
+	}
+
+	out, err := Convert(gradientImage(640, 400), ConvertOptions{Method: CAM16UCS})
+	if err != nil {
+		t.Fatal(err)
+	}
+	palette := make(map[color.RGBA]bool)
+	for _, c := range C64Colors {
+		palette[c] = true
+	}
+	for y := 0; y < out.Rect.Dy(); y++ {
+		for x := 0; x < out.Rect.Dx(); x++ {
+			if !palette[out.RGBAAt(x, y)] {
+				t.Fatalf("pixel %v,%v is %v, not a palette color", x, y, out.RGBAAt(x, y))
+			}
+		}
+	}
+}
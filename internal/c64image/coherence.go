@@ -0,0 +1,72 @@
+package c64image
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// Rematch every block with a penalty for differing from the neighbors chosen
+// in the first pass. The penalty is scaled down by the mask weight.
+func applyCoherence(grid blockGrid, indices []uint8, opts ConvertOptions, m matcher) {
+	weights := maskWeights(opts.Mask, grid)
+	first := append([]uint8(nil), indices...)
+
+	var neighbors []uint8
+	for p := range indices {
+		penalty := opts.Coherence * (1 - weights[p])
+		if penalty == 0 {
+			continue
+		}
+
+		x, y := p%grid.width, p/grid.width
+		neighbors = neighbors[:0]
+		if x > 0 {
+			neighbors = append(neighbors, first[p-1])
+		}
+		if x < grid.width-1 {
+			neighbors = append(neighbors, first[p+1])
+		}
+		if y > 0 {
+			neighbors = append(neighbors, first[p-grid.width])
+		}
+		if y < grid.height-1 {
+			neighbors = append(neighbors, first[p+grid.width])
+		}
+
+		bestIndex := indices[p]
+		bestCost := math.Inf(1)
+		for i, index := range m.indices {
+			cost := math.Sqrt(m.distance(grid.lab[p], grid.rgb[p], i))
+			for _, n := range neighbors {
+				if n != index {
+					cost += penalty
+				}
+			}
+			if cost < bestCost {
+				bestIndex = index
+				bestCost = cost
+			}
+		}
+		indices[p] = bestIndex
+	}
+}
+
+// Sample mask at the center of every block. Returns weights in [0, 1], all
+// zero if there is no mask.
+func maskWeights(mask image.Image, grid blockGrid) []float64 {
+	weights := make([]float64, grid.width*grid.height)
+	if mask == nil {
+		return weights
+	}
+	bounds := mask.Bounds()
+	for j := 0; j < grid.height; j++ {
+		my := bounds.Min.Y + int((float64(j)+.5)*float64(bounds.Dy())/float64(grid.height))
+		for i := 0; i < grid.width; i++ {
+			mx := bounds.Min.X + int((float64(i)+.5)*float64(bounds.Dx())/float64(grid.width))
+			gray := color.GrayModel.Convert(mask.At(mx, my)).(color.Gray)
+			weights[j*grid.width+i] = float64(gray.Y) / 255.
+		}
+	}
+	return weights
+}
@@ -0,0 +1,59 @@
+package c64image
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestMaskedCoherence(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 640, 400))
+	rnd := rand.New(rand.NewSource(1))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(rnd.Intn(256))
+		if i%4 == 3 {
+			img.Pix[i] = 255
+		}
+	}
+
+	// White over the top left quadrant only.
+	mask := image.NewGray(image.Rect(0, 0, 64, 40))
+	fillGray := func(x0, y0, x1, y1 int, y uint8) {
+		for my := y0; my < y1; my++ {
+			for mx := x0; mx < x1; mx++ {
+				mask.SetGray(mx, my, color.Gray{y})
+			}
+		}
+	}
+	fillGray(0, 0, 32, 20, 255)
+
+	opts := ConvertOptions{Method: CIE2000, Coherence: 30, Mask: mask}
+	out, err := Convert(img, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	grid := sampleBlocks(img, sampling{})
+	var inside, outside float64
+	var insideCount, outsideCount int
+	for j := 0; j < grid.height; j++ {
+		for i := 0; i < grid.width; i++ {
+			p := j*grid.width + i
+			deltaE := math.Sqrt(cie2000distance(grid.lab[p], convertRGBAtoCIELAB(out.RGBAAt(i*2, j))))
+			if i < grid.width/2 && j < grid.height/2 {
+				inside += deltaE
+				insideCount++
+			} else {
+				outside += deltaE
+				outsideCount++
+			}
+		}
+	}
+	inside /= float64(insideCount)
+	outside /= float64(outsideCount)
+	if inside >= outside*0.9 {
+		t.Errorf("masked quadrant mean delta-E %v is not clearly below %v", inside, outside)
+	}
+}
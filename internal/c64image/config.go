@@ -0,0 +1,56 @@
+package c64image
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// Methods, dithers and filters are stored by name in JSON.
+
+func (m Method) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *Method) UnmarshalText(text []byte) error {
+	parsed, err := ParseMethod(string(text))
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+func (d Dither) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Dither) UnmarshalText(text []byte) error {
+	parsed, err := ParseDither(string(text))
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+func (f DownscaleFilter) MarshalText() ([]byte, error) {
+	return []byte(f.String()), nil
+}
+
+func (f *DownscaleFilter) UnmarshalText(text []byte) error {
+	parsed, err := ParseDownscaleFilter(string(text))
+	if err != nil {
+		return err
+	}
+	*f = parsed
+	return nil
+}
+
+// ReadConfig decodes JSON encoded options from r on top of opts. Fields that
+// are missing in the JSON keep their value from opts.
+func ReadConfig(r io.Reader, opts ConvertOptions) (ConvertOptions, error) {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&opts)
+	return opts, err
+}
@@ -0,0 +1,49 @@
+package c64image
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestReadConfig(t *testing.T) {
+	config := `{"method": "cie94", "dither": "BlueNoise", "minContrast": 12.5}`
+	opts, err := ReadConfig(strings.NewReader(config), ConvertOptions{Coherence: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := ConvertOptions{Method: CIE94, Dither: BlueNoise, MinContrast: 12.5, Coherence: 3}
+	if opts.Method != expected.Method || opts.Dither != expected.Dither ||
+		opts.MinContrast != expected.MinContrast || opts.Coherence != expected.Coherence {
+		t.Errorf("got %+v, expected %+v", opts, expected)
+	}
+
+	encoded, err := json.Marshal(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(encoded), `"method":"CIE94"`) {
+		t.Errorf("method not encoded by name: %s", encoded)
+	}
+	if strings.Contains(string(encoded), "cropInsets") {
+		t.Errorf("unset CropInsets encoded: %s", encoded)
+	}
+	var decoded ConvertOptions
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Method != CIE94 || decoded.Dither != BlueNoise {
+		t.Errorf("round trip gave %+v", decoded)
+	}
+
+	opts, err = ReadConfig(strings.NewReader(`{"cropInsets": {"top": 5, "bottom": 5}}`), ConvertOptions{})
+	if err != nil || opts.CropInsets == nil || *opts.CropInsets != (Insets{Top: 5, Bottom: 5}) {
+		t.Errorf("got CropInsets %v, %v", opts.CropInsets, err)
+	}
+
+	for _, bad := range []string{`{"method": "CIE1931"}`, `{"dither": "Atkinson"}`, `{"brightness": 2}`} {
+		if _, err := ReadConfig(strings.NewReader(bad), ConvertOptions{}); err == nil {
+			t.Errorf("expected error for %v", bad)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package c64image
+
+import (
+	"math"
+	"sort"
+)
+
+// Recolor regions that are too similar to an adjacent region. Regions are
+// visited from small to large so that details such as text change color while
+// large backgrounds stay as they are. Adjacent regions always differ in color,
+// and since a region is never recolored to match a neighbor this holds
+// throughout the pass.
+func enforceMinContrast(grid blockGrid, indices []uint8, opts ConvertOptions, m matcher) {
+	labels, count := labelRegions(indices, grid.width, grid.height)
+
+	regionIndex := make([]uint8, count)
+	members := make([][]int, count)
+	neighbors := make([]map[int]bool, count)
+	for r := range neighbors {
+		neighbors[r] = make(map[int]bool)
+	}
+	addNeighbors := func(a, b int) {
+		if labels[a] != labels[b] {
+			neighbors[labels[a]][labels[b]] = true
+			neighbors[labels[b]][labels[a]] = true
+		}
+	}
+	for p, r := range labels {
+		regionIndex[r] = indices[p]
+		members[r] = append(members[r], p)
+		if p%grid.width < grid.width-1 {
+			addNeighbors(p, p+1)
+		}
+		if p+grid.width < len(labels) {
+			addNeighbors(p, p+grid.width)
+		}
+	}
+
+	var paletteLab [len(C64Colors)]cielab
+	for i, c := range C64Colors {
+		paletteLab[i] = convertRGBAtoCIELAB(c)
+	}
+	contrast := func(a, b uint8) float64 {
+		return math.Sqrt(cie2000distance(paletteLab[a], paletteLab[b]))
+	}
+	enoughContrast := func(r int, index uint8) bool {
+		for n := range neighbors[r] {
+			if contrast(regionIndex[n], index) < opts.MinContrast {
+				return false
+			}
+		}
+		return true
+	}
+
+	order := make([]int, count)
+	for r := range order {
+		order[r] = r
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return len(members[order[i]]) < len(members[order[j]])
+	})
+
+	for _, r := range order {
+		if enoughContrast(r, regionIndex[r]) {
+			continue
+		}
+		best := -1
+		bestCost := math.Inf(1)
+		for i, index := range m.indices {
+			if !enoughContrast(r, index) {
+				continue
+			}
+			cost := 0.
+			for _, p := range members[r] {
+				cost += m.distance(grid.lab[p], grid.rgb[p], i)
+			}
+			if cost < bestCost {
+				best = int(index)
+				bestCost = cost
+			}
+		}
+		if best >= 0 {
+			regionIndex[r] = uint8(best)
+		}
+	}
+
+	for p, r := range labels {
+		indices[p] = regionIndex[r]
+	}
+}
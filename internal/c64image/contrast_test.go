@@ -0,0 +1,48 @@
+package c64image
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"testing"
+)
+
+func fillImage(img *image.RGBA, rect image.Rectangle, c color.RGBA) {
+	draw.Draw(img, rect, &image.Uniform{c}, image.Point{}, draw.Src)
+}
+
+func paletteContrast(c1, c2 color.RGBA) float64 {
+	return math.Sqrt(cie2000distance(convertRGBAtoCIELAB(c1), convertRGBAtoCIELAB(c2)))
+}
+
+func TestMinContrast(t *testing.T) {
+	yellow, lightGreen := C64Colors[7], C64Colors[13]
+	img := image.NewRGBA(image.Rect(0, 0, 640, 400))
+	fillImage(img, img.Rect, yellow)
+	fillImage(img, image.Rect(200, 100, 280, 200), lightGreen)
+
+	plain, err := Convert(img, ConvertOptions{Method: CIE2000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := paletteContrast(plain.RGBAAt(0, 0), plain.RGBAAt(120, 75))
+
+	const minContrast = 20.
+	adjusted, err := Convert(img, ConvertOptions{Method: CIE2000, MinContrast: minContrast})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if adjusted.RGBAAt(0, 0) != yellow {
+		t.Errorf("background changed to %v", adjusted.RGBAAt(0, 0))
+	}
+	after := paletteContrast(adjusted.RGBAAt(0, 0), adjusted.RGBAAt(120, 75))
+	if after < minContrast || after <= before {
+		t.Errorf("contrast %v before and %v after, expected at least %v", before, after, minContrast)
+	}
+
+	if _, err := Convert(img, ConvertOptions{MinContrast: -1}); !errors.Is(err, InvalidOptionsError) {
+		t.Errorf("expected InvalidOptionsError, got %v", err)
+	}
+}
@@ -4,11 +4,13 @@ import (
 	"fmt"
 	"image"
 	"image/color"
-	"image/draw"
 	_ "image/jpeg"
 	"image/png"
+	"io"
 	"math"
 	"os"
+	"strings"
+	"time"
 )
 
 // According to http://hitmen.c02.at/temp/palstuff/
@@ -33,9 +35,13 @@ var C64Colors = [16]color.RGBA{
 
 var UnsupportedStrideError = fmt.Errorf("unsupported stride")
 
-func almostZero(x float64) bool {
-	return math.Abs(x) < 1e-8
-}
+// Chroma below which CIE2000 treats a color as neutral, with chroma and hue
+// 0 as in Sharma's reference implementation. Grays converted from sRGB have
+// a chroma up to about 2e-5 rather than 0, as the white point constants are
+// rounded, which would otherwise give them an arbitrary hue that leaks into
+// the mean hue of a pair. Chroma differences this small are far below
+// anything visible.
+const neutralChroma = 1e-4
 
 type cielab struct {
 	l float64
@@ -55,9 +61,14 @@ type rgb struct {
 	b float64
 }
 
+// Size of the C64 screen in pixels. Conversion targets the multicolor
+// grid, whose logical pixels are two screen pixels wide.
 const (
-	C64Width  = 320
-	C64Height = 200
+	C64Width           = 320
+	C64Height          = 200
+	C64MulticolorWidth = C64Width / 2
+
+	logicalPixelWidth = C64Width / C64MulticolorWidth
 )
 
 type Method int
@@ -67,123 +78,790 @@ const (
 	CIE76
 	CIE94
 	CIE2000
+	CAM16UCS
 )
 
+func (m Method) String() string {
+	switch m {
+	case RGBMethod:
+		return "RGB"
+	case CIE76:
+		return "CIE76"
+	case CIE94:
+		return "CIE94"
+	case CIE2000:
+		return "CIE2000"
+	case CAM16UCS:
+		return "CAM16UCS"
+	}
+	return fmt.Sprintf("Method(%d)", int(m))
+}
+
+// ParseMethod returns the method whose String matches name, ignoring case.
+func ParseMethod(name string) (Method, error) {
+	for m := RGBMethod; m <= CAM16UCS; m++ {
+		if strings.EqualFold(m.String(), name) {
+			return m, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown method %q", name)
+}
+
 const (
 	deg2rad = math.Pi / 180.
 	rad2deg = 180. / math.Pi
 )
 
+// LoadImage loads filename with DefaultLoadOptions, so only the first frame
+// of an animated file is used.
 func LoadImage(filename string) (*image.RGBA, error) {
-	file, err := os.Open(filename)
+	return LoadImageWithOptions(filename, DefaultLoadOptions)
+}
+
+func SaveImage(img *image.RGBA, filename string) error {
+	file, err := os.Create(filename)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	return writePNG(file, img)
+}
+
+// Encode img as PNG to w and close it, returning the first error.
+func writePNG(w io.WriteCloser, img *image.RGBA) error {
+	if err := png.Encode(w, img); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// ConvertOptions controls Convert. The zero value matches colors with
+// RGBMethod and applies no post-processing.
+//
+// Options are JSON encodable except for those holding images, matrices and
+// maps, which have to be set in code.
+type ConvertOptions struct {
+	Method Method `json:"method"`
+
+	// Dither selects how quantization error is spread to nearby blocks.
+	Dither Dither `json:"dither"`
+
+	// ThresholdMatrix is the pattern used by the Ordered dither.
+	ThresholdMatrix *ThresholdMatrix `json:"-"`
+
+	// SnapPrimaries maps blocks whose mean color has every channel at 0 or
+	// 255 directly to a palette index, regardless of Method and Dither.
+	// Colors missing from the map are matched as usual. DefaultPrimaries
+	// holds the obvious choices.
+	SnapPrimaries map[color.RGBA]uint8 `json:"-"`
+
+	// MinContrast is the smallest delta-E (CIE2000) allowed between adjacent
+	// regions of different colors. The smaller region of a pair that is
+	// closer than this is recolored to the nearest palette color that has
+	// enough contrast to all of its neighbors. Zero disables the pass.
+	MinContrast float64 `json:"minContrast,omitempty"`
+
+	// Coherence penalizes every 4-connected neighbor whose color from a first
+	// nearest-color pass differs from the candidate, trading fidelity for
+	// smoother areas. It is given in unsquared distance units of the method:
+	// channel steps for RGBMethod and delta-E otherwise. Zero disables it.
+	Coherence float64 `json:"coherence,omitempty"`
+
+	// Mask weights fidelity per region when Coherence is used. It is
+	// stretched over the source image and read as grayscale: white areas are
+	// matched without penalty, black areas get the full Coherence penalty and
+	// gray scales it linearly. Nil applies the full penalty everywhere.
+	Mask image.Image `json:"-"`
+
+	// MaxScreenColors limits the whole image to this many palette colors.
+	// The subset with the lowest total error over all blocks is picked
+	// before matching, and every later step only uses those colors. Zero
+	// allows the full palette.
+	MaxScreenColors int `json:"maxScreenColors,omitempty"`
+
+	// AutoLevels stretches every channel of the source so that it spans 0
+	// to 255 before blocks are averaged, which makes better use of the
+	// palette for flat scans.
+	AutoLevels bool `json:"autoLevels,omitempty"`
+
+	// AutoLevelsClip is the fraction of the darkest and of the brightest
+	// values per channel that AutoLevels ignores as outliers when finding the
+	// range, for example .01 for the 1st and 99th percentile.
+	AutoLevelsClip float64 `json:"autoLevelsClip,omitempty"`
+
+	// MaxAspectRatio limits how much longer one side of the source may be
+	// than the other. A longer source, such as a panorama, is cropped to the
+	// center part with the screen's 320:200 shape instead of being squeezed
+	// into a few rows. ConvertTiles splits it into several screens instead.
+	// It must be at least 1.6; zero allows any shape.
+	MaxAspectRatio float64 `json:"maxAspectRatio,omitempty"`
+
+	// BlockOverlap enlarges the source area averaged for every block by this
+	// factor around the block's center, weighting pixels down with their
+	// distance from it. This supersamples the source and reduces aliasing
+	// of thin features. Values up to 1 average each block on its own.
+	BlockOverlap float64 `json:"blockOverlap,omitempty"`
+
+	// LightnessWeight and ChromaWeight scale the lightness and chroma
+	// differences in CIE94 and CIE2000, biasing matches towards getting
+	// brightness or saturation right at the expense of hue. Zero means 1,
+	// the standard formulas.
+	LightnessWeight float64 `json:"lightnessWeight,omitempty"`
+	ChromaWeight    float64 `json:"chromaWeight,omitempty"`
+
+	// ChromaOnlyDither makes FloydSteinberg diffuse only the a* and b*
+	// error in CIELAB. Color banding is smoothed while lightness, and with
+	// it fine detail, is quantized without dither noise.
+	ChromaOnlyDither bool `json:"chromaOnlyDither,omitempty"`
+
+	// TemporalTolerance is the CIE2000 delta-E below which a block of an
+	// animation frame counts as unchanged and keeps its color from the
+	// previous frame, see Converter.ConvertFrame and ConvertGIF. Zero
+	// converts every frame on its own, as do MaxScreenColors, Coherence,
+	// MinContrast, PreserveBrightness and ExtendedPalette, whose results
+	// kept colors could break.
+	TemporalTolerance float64 `json:"temporalTolerance,omitempty"`
+
+	// CropInsets removes a percentage of the source from each edge before
+	// conversion, for example the frame around a photographed screen. Nil
+	// keeps the whole source.
+	CropInsets *Insets `json:"cropInsets,omitempty"`
+
+	// TrimBars removes dark bars, such as letterboxing, from the edges of
+	// the source after CropInsets. A row or column at the edge is a bar if
+	// no channel of any of its pixels exceeds TrimTolerance. TrimTolerance
+	// zero uses 16.
+	TrimBars      bool    `json:"trimBars,omitempty"`
+	TrimTolerance float64 `json:"trimTolerance,omitempty"`
+
+	// AlphaWeighted weights source pixels by their alpha when averaging
+	// blocks, so that nearly transparent pixels barely count. Blocks whose
+	// pixels are all fully transparent get palette color BackgroundIndex.
+	// Without it transparent pixels count as black.
+	AlphaWeighted   bool  `json:"alphaWeighted,omitempty"`
+	BackgroundIndex uint8 `json:"backgroundIndex,omitempty"`
+
+	// ExtendedPalette matches every 2x2 group of logical pixels against the
+	// palette colors and all checkerboard mixes of two of them, 136 colors
+	// in total, and draws the group as the pattern of the closest one. It
+	// replaces dithering and can't be combined with it, Coherence or
+	// MinContrast, which would break up the patterns.
+	ExtendedPalette bool `json:"extendedPalette,omitempty"`
+
+	// ClampChroma reduces the chroma of every block to the most the palette
+	// can reach at its hue and lightness, even by mixing, before matching.
+	// Dithering then spreads only error it can make up for instead of a
+	// constant offset towards colors out of reach.
+	ClampChroma bool `json:"clampChroma,omitempty"`
+
+	// DownscaleFilter selects how the source is reduced to the logical
+	// grid. Box, the default, averages every block. Lanczos resamples the
+	// source and can't be combined with BlockOverlap, AlphaWeighted or
+	// SamplingJitter.
+	DownscaleFilter DownscaleFilter `json:"downscaleFilter,omitempty"`
+
+	// SamplingJitter shifts the area averaged for every block by up to half
+	// this fraction of a block in each direction, differently for every
+	// block. Band edges of smooth gradients then no longer line up with the
+	// grid. JitterSeed selects the pattern, so results are reproducible.
+	SamplingJitter float64 `json:"samplingJitter,omitempty"`
+	JitterSeed     int64   `json:"jitterSeed,omitempty"`
+
+	// PreserveBrightness keeps the mean CIELAB lightness of the result within
+	// this many units of the mean of the source blocks. Quantization and
+	// dithering can make an image darker or lighter overall; the blocks with
+	// the least extra error are then recolored to a lighter or darker
+	// palette color until it is close enough. Zero disables the pass.
+	PreserveBrightness float64 `json:"preserveBrightness,omitempty"`
+
+	// DebugDir, if set, is a directory that receives the intermediate images
+	// of every conversion: the source after cropping and AutoLevels, the
+	// mean color of every block before matching and the result, named
+	// <method>_source.png, <method>_blocks.png and <method>_result.png.
+	// ConvertDir prefixes them with the name of the source file.
+	DebugDir string `json:"debugDir,omitempty"`
+
+	// Prefix of the DebugDir file names, set by ConvertDir.
+	debugName string
+
+	// Set by ConvertAutoMethod while sampling, before the method is known.
+	autoMethod bool
+}
+
+var InvalidOptionsError = fmt.Errorf("invalid options")
+
+func (opts ConvertOptions) validate() error {
+	switch {
+	case opts.Method < RGBMethod || opts.Method > CAM16UCS:
+		return fmt.Errorf("%w: unknown Method %d", InvalidOptionsError, opts.Method)
+	case opts.MinContrast < 0:
+		return fmt.Errorf("%w: negative MinContrast", InvalidOptionsError)
+	case opts.Coherence < 0:
+		return fmt.Errorf("%w: negative Coherence", InvalidOptionsError)
+	case opts.Dither < NoDither || opts.Dither > Ordered:
+		return fmt.Errorf("%w: unknown Dither %d", InvalidOptionsError, opts.Dither)
+	case opts.MaxScreenColors < 0 || opts.MaxScreenColors > len(C64Colors):
+		return fmt.Errorf("%w: MaxScreenColors %d outside 0 to %d", InvalidOptionsError, opts.MaxScreenColors, len(C64Colors))
+	case opts.AutoLevelsClip < 0 || opts.AutoLevelsClip >= .5:
+		return fmt.Errorf("%w: AutoLevelsClip %v outside [0, 0.5)", InvalidOptionsError, opts.AutoLevelsClip)
+	case opts.MaxAspectRatio != 0 && opts.MaxAspectRatio < screenAspect:
+		return fmt.Errorf("%w: MaxAspectRatio %v below the screen's %v", InvalidOptionsError, opts.MaxAspectRatio, screenAspect)
+	case opts.LightnessWeight < 0 || opts.ChromaWeight < 0:
+		return fmt.Errorf("%w: negative LightnessWeight or ChromaWeight", InvalidOptionsError)
+	case opts.TemporalTolerance < 0:
+		return fmt.Errorf("%w: negative TemporalTolerance", InvalidOptionsError)
+	case opts.CropInsets != nil && (opts.CropInsets.Top < 0 || opts.CropInsets.Right < 0 || opts.CropInsets.Bottom < 0 || opts.CropInsets.Left < 0 ||
+		opts.CropInsets.Top+opts.CropInsets.Bottom >= 100 || opts.CropInsets.Left+opts.CropInsets.Right >= 100):
+		return fmt.Errorf("%w: CropInsets %+v leave nothing of the image", InvalidOptionsError, *opts.CropInsets)
+	case int(opts.BackgroundIndex) >= len(C64Colors):
+		return fmt.Errorf("%w: BackgroundIndex %d outside the palette", InvalidOptionsError, opts.BackgroundIndex)
+	case opts.TrimTolerance < 0:
+		return fmt.Errorf("%w: negative TrimTolerance", InvalidOptionsError)
+	case opts.BlockOverlap < 0:
+		return fmt.Errorf("%w: negative BlockOverlap", InvalidOptionsError)
+	case opts.ChromaOnlyDither && opts.Dither != FloydSteinberg:
+		return fmt.Errorf("%w: ChromaOnlyDither without FloydSteinberg", InvalidOptionsError)
+	case opts.ExtendedPalette && (opts.Dither != NoDither || opts.Coherence > 0 || opts.MinContrast > 0):
+		return fmt.Errorf("%w: ExtendedPalette with Dither, Coherence or MinContrast", InvalidOptionsError)
+	case opts.DownscaleFilter < Box || opts.DownscaleFilter > Lanczos:
+		return fmt.Errorf("%w: unknown DownscaleFilter %d", InvalidOptionsError, opts.DownscaleFilter)
+	case opts.SamplingJitter < 0 || opts.SamplingJitter > 1:
+		return fmt.Errorf("%w: SamplingJitter %v outside [0, 1]", InvalidOptionsError, opts.SamplingJitter)
+	case opts.DownscaleFilter == Lanczos && (opts.BlockOverlap > 0 || opts.AlphaWeighted || opts.SamplingJitter > 0):
+		return fmt.Errorf("%w: Lanczos with BlockOverlap, AlphaWeighted or SamplingJitter", InvalidOptionsError)
+	case opts.PreserveBrightness < 0:
+		return fmt.Errorf("%w: negative PreserveBrightness", InvalidOptionsError)
+	case opts.ExtendedPalette && opts.PreserveBrightness > 0:
+		return fmt.Errorf("%w: ExtendedPalette with PreserveBrightness", InvalidOptionsError)
+	case opts.Dither == Ordered && opts.ThresholdMatrix == nil:
+		return fmt.Errorf("%w: Ordered dither without ThresholdMatrix", InvalidOptionsError)
+	}
+	for c, index := range opts.SnapPrimaries {
+		if int(index) >= len(C64Colors) {
+			return fmt.Errorf("%w: SnapPrimaries maps %v to missing palette index %d", InvalidOptionsError, c, index)
+		}
+	}
+	return nil
+}
+
+func (opts ConvertOptions) withMethod(method Method) ConvertOptions {
+	opts.Method = method
+	return opts
+}
+
+// Threshold matrix of the ordered dither modes, nil for other modes.
+func (opts ConvertOptions) thresholdMatrix() *ThresholdMatrix {
+	switch opts.Dither {
+	case Bayer:
+		return bayerMatrix
+	case BlueNoise:
+		return blueNoiseTexture
+	case Ordered:
+		return opts.ThresholdMatrix
 	}
-	defer file.Close()
-	img, _, err := image.Decode(file)
+	return nil
+}
+
+// Mean colors of the blocks making up the logical C64 grid. Every logical
+// pixel is two pixels wide in the converted image.
+type blockGrid struct {
+	width       int
+	height      int
+	blockWidth  float64
+	blockHeight float64
+	sampling    sampling
+	lab         []cielab
+	rgb         []color.RGBA
+}
+
+func ConvertImage(img *image.RGBA, method Method, returnChannel chan *image.RGBA) {
+	targetImage, _ := Convert(img, ConvertOptions{Method: method})
+	returnChannel <- targetImage
+}
+
+// Convert img to C64 resolution and colors.
+func Convert(img *image.RGBA, opts ConvertOptions) (*image.RGBA, error) {
+	result, err := convertResult(img, opts)
 	if err != nil {
 		return nil, err
 	}
-	rgba := image.NewRGBA(img.Bounds())
-	if rgba.Stride != rgba.Rect.Size().X*4 {
-		return nil, UnsupportedStrideError
+	return result.Image, nil
+}
+
+// ConvertWithScore converts like Convert and also returns the mean CIE2000
+// delta-E between every block of the source and its palette color.
+func ConvertWithScore(img *image.RGBA, opts ConvertOptions) (*image.RGBA, float64, error) {
+	grid, indices, err := convertBlocks(img, opts, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	score := 0.
+	for i, index := range indices {
+		score += math.Sqrt(cie2000distance(grid.lab[i], convertRGBAtoCIELAB(C64Colors[index])))
 	}
-	draw.Draw(rgba, rgba.Bounds(), img, image.Point{0, 0}, draw.Src)
-	return rgba, nil
+	score /= float64(len(indices))
+	return renderIndices(indices, grid.width, grid.height), score, nil
 }
 
-func SaveImage(img *image.RGBA, filename string) error {
-	file, err := os.Create(filename)
+// Sample img and match every block to a palette index. Phase durations are
+// stored in metrics unless it is nil.
+func convertBlocks(img *image.RGBA, opts ConvertOptions, metrics *Metrics) (blockGrid, []uint8, error) {
+	if err := opts.validate(); err != nil {
+		return blockGrid{}, nil, err
+	}
+	if metrics == nil {
+		metrics = &Metrics{}
+	}
+	grid, err := sampleSource(img, opts, metrics)
 	if err != nil {
-		return err
+		return blockGrid{}, nil, err
 	}
-	defer file.Close()
-	png.Encode(file, img)
-	return nil
+	indices, err := matchGrid(grid, opts, metrics)
+	if err != nil {
+		return blockGrid{}, nil, err
+	}
+	return grid, indices, nil
 }
 
-func ConvertImage(img *image.RGBA, method Method, returnChannel chan *image.RGBA) {
-	aspectRatio := float64(img.Rect.Size().X) / float64(img.Rect.Size().Y)
+// Crop and preprocess img and average it into blocks. The grid does not
+// depend on the method.
+func sampleSource(img *image.RGBA, opts ConvertOptions, metrics *Metrics) (blockGrid, error) {
+	img = opts.cropSource(img)
+
+	if opts.AutoLevels {
+		start := time.Now()
+		img = autoLevels(img, opts.AutoLevelsClip)
+		metrics.Preprocess = time.Since(start)
+	}
+
+	if err := opts.saveDebugImage("source", img); err != nil {
+		return blockGrid{}, err
+	}
+
+	start := time.Now()
+	grid := sampleBlocks(img, opts.sampling())
+	metrics.Sample = time.Since(start)
+	if err := opts.saveDebugImage("blocks", renderBlocks(grid)); err != nil {
+		return blockGrid{}, err
+	}
+	return grid, nil
+}
+
+// Match every block of grid to a palette index and run the passes after
+// matching.
+func matchGrid(grid blockGrid, opts ConvertOptions, metrics *Metrics) ([]uint8, error) {
+	m := opts.matcher()
+	start := time.Now()
+	if opts.MaxScreenColors > 0 {
+		m = m.restrict(selectScreenColors(grid, m, opts.MaxScreenColors))
+		metrics.ScreenColors = time.Since(start)
+	}
+
+	start = time.Now()
+	var indices []uint8
+	switch {
+	case opts.ExtendedPalette:
+		indices = matchExtended(grid, m)
+	case opts.Dither == NoDither:
+		indices = matchBlocks(grid, m)
+	case opts.Dither == FloydSteinberg:
+		indices = ditherBlocks(grid, m, ditherStripHeight, opts.ChromaOnlyDither)
+	default:
+		indices = orderedDither(grid, m, opts.thresholdMatrix())
+	}
+	metrics.Match = time.Since(start)
+
+	if opts.SnapPrimaries != nil {
+		start = time.Now()
+		snapPrimaries(grid, indices, opts.SnapPrimaries, m)
+		metrics.SnapPrimaries = time.Since(start)
+	}
+	if opts.Coherence > 0 {
+		start = time.Now()
+		applyCoherence(grid, indices, opts, m)
+		metrics.Coherence = time.Since(start)
+	}
+	if opts.PreserveBrightness > 0 {
+		start = time.Now()
+		preserveBrightness(grid, indices, opts, m)
+		metrics.Brightness = time.Since(start)
+	}
+	if opts.MinContrast > 0 {
+		start = time.Now()
+		enforceMinContrast(grid, indices, opts, m)
+		metrics.MinContrast = time.Since(start)
+	}
+	if err := opts.saveDebugImage("result", renderIndices(indices, grid.width, grid.height)); err != nil {
+		return nil, err
+	}
+	return indices, nil
+}
+
+// How source pixels are averaged into blocks.
+type sampling struct {
+	overlap    float64      // ConvertOptions.BlockOverlap
+	alpha      bool         // ConvertOptions.AlphaWeighted
+	background color.RGBA   // color of fully transparent blocks with alpha
+	gamut      *chromaGamut // ConvertOptions.ClampChroma
+	filter     DownscaleFilter
+	jitter     float64 // ConvertOptions.SamplingJitter
+	seed       int64   // ConvertOptions.JitterSeed
+}
+
+func (opts ConvertOptions) sampling() sampling {
+	s := sampling{
+		overlap:    opts.BlockOverlap,
+		alpha:      opts.AlphaWeighted,
+		background: C64Colors[opts.BackgroundIndex],
+		filter:     opts.DownscaleFilter,
+		jitter:     opts.SamplingJitter,
+		seed:       opts.JitterSeed,
+	}
+	if opts.ClampChroma {
+		s.gamut = &c64Gamut
+	}
+	return s
+}
 
-	targetWidth := 320
-	targetHeight := int(math.Ceil(float64(targetWidth) / aspectRatio))
+func sampleBlocks(img *image.RGBA, s sampling) blockGrid {
+	aspectRatio := float64(img.Rect.Size().X) / float64(img.Rect.Size().Y)
 
-	targetImage := image.NewRGBA(image.Rect(0, 0, targetWidth, targetHeight))
+	targetHeight := int(math.Ceil(float64(C64Width) / aspectRatio))
 
-	blockWidth := int(float64(img.Rect.Size().X) / float64(targetWidth/2))
-	blockHeight := int(float64(img.Rect.Size().Y) / float64(targetHeight))
+	grid := blockGrid{
+		width:    C64MulticolorWidth,
+		height:   targetHeight,
+		sampling: s,
+		lab:      make([]cielab, C64MulticolorWidth*targetHeight),
+		rgb:      make([]color.RGBA, C64MulticolorWidth*targetHeight),
+	}
+	grid.blockWidth = float64(img.Rect.Size().X) / float64(grid.width)
+	grid.blockHeight = float64(img.Rect.Size().Y) / float64(grid.height)
 
-	for j := 0; j < targetHeight; j++ {
-		for i := 0; i <= targetWidth; i++ {
-			colorEstimate, rgbEstimate := meanBlockColor(img,
-				image.Rect(i*blockWidth, j*blockHeight, (i+1)*blockWidth-1, (j+1)*blockHeight-1))
-			ci := closestC64Color(colorEstimate, rgbEstimate, method)
-			targetImage.SetRGBA(i*2, j, C64Colors[ci])
-			targetImage.SetRGBA(i*2+1, j, C64Colors[ci])
+	if s.filter == Lanczos {
+		lanczosBlocks(img, grid)
+		return grid
+	}
+	for j := 0; j < grid.height; j++ {
+		for i := 0; i < grid.width; i++ {
+			grid.lab[j*grid.width+i], grid.rgb[j*grid.width+i] = meanBlockColor(img, grid.blockArea(i, j), s)
 		}
 	}
+	return grid
+}
 
-	returnChannel <- targetImage
+// Rectangle in source pixel coordinates, relative to the image origin, with
+// fractional edges.
+type area struct {
+	x0, y0, x1, y1 float64
 }
 
-// Calculate mean color of image block.
-func meanBlockColor(img *image.RGBA, rect image.Rectangle) (cielab, color.RGBA) {
+// Smallest rectangle of whole pixels containing a.
+func (a area) bounds() image.Rectangle {
+	return image.Rect(int(math.Floor(a.x0)), int(math.Floor(a.y0)),
+		int(math.Ceil(a.x1)), int(math.Ceil(a.y1)))
+}
+
+// a scaled by factor around its center. Factors up to 1 keep a unchanged.
+func (a area) expand(factor float64) area {
+	if factor <= 1 {
+		return a
+	}
+	dx, dy := (a.x1-a.x0)*(factor-1)/2., (a.y1-a.y0)*(factor-1)/2.
+	return area{a.x0 - dx, a.y0 - dy, a.x1 + dx, a.y1 + dy}
+}
+
+// Source area sampled for logical pixel i, j. Blocks are generally not a
+// whole number of pixels, so pixels on the edges are partially covered.
+func (grid blockGrid) blockArea(i, j int) area {
+	var dx, dy float64
+	if grid.sampling.jitter > 0 {
+		dx, dy = jitterOffset(grid.sampling.seed, i, j)
+		dx *= grid.sampling.jitter * grid.blockWidth
+		dy *= grid.sampling.jitter * grid.blockHeight
+	}
+	return area{
+		float64(i)*grid.blockWidth + dx, float64(j)*grid.blockHeight + dy,
+		float64(i+1)*grid.blockWidth + dx, float64(j+1)*grid.blockHeight + dy,
+	}
+}
+
+// Pseudo-random offset in [-.5, .5) in both directions for block i, j. It
+// only depends on its arguments, so blocks can be sampled in any order.
+func jitterOffset(seed int64, i, j int) (float64, float64) {
+	// SplitMix64 finalizer.
+	z := uint64(seed) + uint64(i)*0x9E3779B97F4A7C15 + uint64(j)*0xC2B2AE3D27D4EB4F
+	z = (z ^ z>>30) * 0xBF58476D1CE4E5B9
+	z = (z ^ z>>27) * 0x94D049BB133111EB
+	z ^= z >> 31
+	return float64(z>>32)/(1<<32) - .5, float64(z&0xFFFFFFFF)/(1<<32) - .5
+}
+
+// Find palette index of every block.
+func matchBlocks(grid blockGrid, m matcher) []uint8 {
+	indices := make([]uint8, len(grid.lab))
+	for i := range indices {
+		indices[i] = m.closest(grid.lab[i], grid.rgb[i])
+	}
+	return indices
+}
+
+// Draw index map with every logical pixel doubled horizontally.
+func renderIndices(indices []uint8, width, height int) *image.RGBA {
+	targetImage := image.NewRGBA(image.Rect(0, 0, width*logicalPixelWidth, height))
+	for j := 0; j < height; j++ {
+		for i := 0; i < width; i++ {
+			c := C64Colors[indices[j*width+i]]
+			for k := 0; k < logicalPixelWidth; k++ {
+				targetImage.SetRGBA(i*logicalPixelWidth+k, j, c)
+			}
+		}
+	}
+	return targetImage
+}
+
+// Calculate mean color of image block. Every pixel is weighted by how much of
+// it is covered by the block, like a box filter with sub-pixel edges.
+func meanBlockColor(img *image.RGBA, block area, s sampling) (cielab, color.RGBA) {
 	avglab := cielab{0, 0, 0}
 	avgrgb := rgb{0, 0, 0}
-	var rgbColor color.RGBA
-	for x := rect.Min.X; x < rect.Max.X; x++ {
-		for y := rect.Min.Y; y < rect.Max.Y; y++ {
-			rgbColor = img.RGBAAt(x, y)
+	totalWeight := 0.
+
+	region := block.expand(s.overlap)
+	// Weight of the pixel from v to v+1 along one axis: the part of it
+	// inside the block counts fully, the part in the margin around it is
+	// weighted down linearly with the distance from the block, reaching
+	// zero at the edge of the region. The weights thus grow continuously
+	// from the plain block average as the overlap exceeds 1.
+	weigh := func(v, blockFrom, blockTo, from, to float64) float64 {
+		w := math.Max(0., math.Min(v+1, blockTo)-math.Max(v, blockFrom))
+		if a, b := math.Max(v, from), math.Min(v+1, blockFrom); b > a {
+			w += ((b-from)*(b-from) - (a-from)*(a-from)) / (2. * (blockFrom - from))
+		}
+		if a, b := math.Max(v, blockTo), math.Min(v+1, to); b > a {
+			w += ((to-a)*(to-a) - (to-b)*(to-b)) / (2. * (to - blockTo))
+		}
+		return w
+	}
+
+	bounds := region.bounds().Intersect(image.Rect(0, 0, img.Rect.Dx(), img.Rect.Dy()))
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		weightY := weigh(float64(y), block.y0, block.y1, region.y0, region.y1)
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			weight := weightY * weigh(float64(x), block.x0, block.x1, region.x0, region.x1)
+			rgbColor := img.RGBAAt(img.Rect.Min.X+x, img.Rect.Min.Y+y)
+			if s.alpha {
+				// Pixels are premultiplied, so the color of a translucent
+				// pixel is darkened unless it is divided by alpha.
+				if rgbColor.A == 0 {
+					continue
+				}
+				weight *= float64(rgbColor.A) / 255.
+				rgbColor = unpremultiply(rgbColor)
+			}
 			lab := convertRGBAtoCIELAB(rgbColor)
-			avglab.l += lab.l
-			avglab.a += lab.a
-			avglab.b += lab.b
+			avglab.l += weight * lab.l
+			avglab.a += weight * lab.a
+			avglab.b += weight * lab.b
 
-			avgrgb.r += float64(rgbColor.R)
-			avgrgb.g += float64(rgbColor.G)
-			avgrgb.b += float64(rgbColor.B)
+			avgrgb.r += weight * float64(rgbColor.R)
+			avgrgb.g += weight * float64(rgbColor.G)
+			avgrgb.b += weight * float64(rgbColor.B)
+			totalWeight += weight
 		}
 	}
-	pixelCount := float64((rect.Max.X - rect.Min.X) * (rect.Max.Y - rect.Min.Y))
 
-	avglab.l /= pixelCount
-	avglab.a /= pixelCount
-	avglab.b /= pixelCount
+	if totalWeight == 0 {
+		return convertRGBAtoCIELAB(s.background), s.background
+	}
 
-	avgrgb.r /= pixelCount
-	avgrgb.g /= pixelCount
-	avgrgb.b /= pixelCount
+	avglab.l /= totalWeight
+	avglab.a /= totalWeight
+	avglab.b /= totalWeight
 
-	avgrgbColor := color.RGBA{uint8(avgrgb.r), uint8(avgrgb.g), uint8(avgrgb.b), 255}
+	avgrgb.r /= totalWeight
+	avgrgb.g /= totalWeight
+	avgrgb.b /= totalWeight
 
+	avgrgbColor := color.RGBA{
+		uint8(math.Round(avgrgb.r)),
+		uint8(math.Round(avgrgb.g)),
+		uint8(math.Round(avgrgb.b)),
+		255,
+	}
+
+	if s.gamut != nil {
+		if clamped := s.gamut.clamp(avglab); clamped != avglab {
+			return clamped, convertCIELABtoRGBA(clamped)
+		}
+	}
 	return avglab, avgrgbColor
 }
 
-// Find index of closest color in C64Colors.
+func unpremultiply(c color.RGBA) color.RGBA {
+	if c.A == 0xFF || c.A == 0 {
+		return color.RGBA{c.R, c.G, c.B, 0xFF}
+	}
+	a := int(c.A)
+	channel := func(v uint8) uint8 { return uint8((int(v)*0xFF + a/2) / a) }
+	return color.RGBA{channel(c.R), channel(c.G), channel(c.B), 0xFF}
+}
+
+// Find index of closest color in C64Colors. Of equally close colors the one
+// with the lowest index wins.
 func closestC64Color(color cielab, rgbColor color.RGBA, method Method) int {
-	bestIndex := 0
-	bestDistance := math.Inf(1)
-	for i, c64Color := range C64Colors {
-		lab2 := convertRGBAtoCIELAB(c64Color)
-
-		var deltaE float64
-		switch method {
-		case RGBMethod:
-			deltaE = rgbDistance(rgbColor, c64Color)
-		case CIE76:
-			deltaE = cie76distance(color, lab2)
-		case CIE94:
-			deltaE = cie94distance(color, lab2)
-		case CIE2000:
-			deltaE = cie2000distance(color, lab2)
+	return int(fullMatcher(method).closest(color, rgbColor))
+}
+
+// Palette entries that a conversion may choose from, with their CIELAB
+// (and for CAM16UCS their CAM16-UCS) values computed once.
+type matcher struct {
+	method  Method
+	indices []uint8
+	rgb     []color.RGBA
+	lab     []cielab
+	ucs     []cam16ucs
+	weights labWeights
+	sorted  *sortedEntries // for large matchers only
+}
+
+// Factors for the lightness and chroma terms of CIE94 and CIE2000. They are
+// the reciprocals of the standard parametric factors kL and kC.
+type labWeights struct {
+	l, c float64
+}
+
+func newMatcher(method Method, indices []uint8) matcher {
+	colors := make([]color.RGBA, len(indices))
+	for i, index := range indices {
+		colors[i] = C64Colors[index]
+	}
+	m := colorMatcher(method, colors)
+	m.indices = indices
+	return m
+}
+
+// Matcher choosing from arbitrary colors. It has no palette indices, so
+// entries are found with closestEntry.
+func colorMatcher(method Method, colors []color.RGBA) matcher {
+	m := matcher{method: method, rgb: colors, lab: make([]cielab, len(colors)), weights: labWeights{1., 1.}}
+	for i, c := range colors {
+		m.lab[i] = convertRGBAtoCIELAB(c)
+	}
+	if method == CAM16UCS {
+		m.ucs = make([]cam16ucs, len(colors))
+		for i, c := range colors {
+			m.ucs[i] = convertXYZtoCAM16UCS(convertRGBAtoXYZ(c))
 		}
+	}
+	if len(colors) >= sortedMatchEntries {
+		m.sorted = m.sortEntries()
+	}
+	return m
+}
+
+// Matcher choosing from all of C64Colors.
+func fullMatcher(method Method) matcher {
+	indices := make([]uint8, len(C64Colors))
+	for i := range indices {
+		indices[i] = uint8(i)
+	}
+	return newMatcher(method, indices)
+}
 
+// Matcher for opts choosing from all of C64Colors.
+func (opts ConvertOptions) matcher() matcher {
+	m := fullMatcher(opts.Method)
+	if opts.LightnessWeight > 0 {
+		m.weights.l = opts.LightnessWeight
+	}
+	if opts.ChromaWeight > 0 {
+		m.weights.c = opts.ChromaWeight
+	}
+	return m
+}
+
+// Matcher like m that only chooses from indices.
+func (m matcher) restrict(indices []uint8) matcher {
+	restricted := newMatcher(m.method, indices)
+	restricted.weights = m.weights
+	return restricted
+}
+
+// Distance from a source color to entry i of the matcher.
+func (m matcher) distance(color cielab, rgbColor color.RGBA, i int) float64 {
+	switch m.method {
+	case RGBMethod:
+		return rgbDistance(rgbColor, m.rgb[i])
+	case CAM16UCS:
+		return cam16ucsDistance(convertCIELABtoCAM16UCS(color), m.ucs[i])
+	case CIE94:
+		return weightedCIE94(color, m.lab[i], m.weights)
+	case CIE2000:
+		return weightedCIE2000(color, m.lab[i], m.weights)
+	}
+	return labDistance(color, m.lab[i], m.method)
+}
+
+// Index in C64Colors of the closest entry. Ties go to the entry that comes
+// first, so matchers must list their indices in ascending order for the
+// lowest palette index to win.
+func (m matcher) closest(color cielab, rgbColor color.RGBA) uint8 {
+	return m.indices[m.closestEntry(color, rgbColor)]
+}
+
+// Position of the closest entry in the matcher.
+func (m matcher) closestEntry(color cielab, rgbColor color.RGBA) int {
+	distance := func(i int) float64 { return m.distance(color, rgbColor, i) }
+	key := color.l
+	switch m.method {
+	case RGBMethod:
+		key = float64(rgbColor.G)
+	case CAM16UCS:
+		// Convert the source once instead of for every entry.
+		source := convertCIELABtoCAM16UCS(color)
+		distance = func(i int) float64 { return cam16ucsDistance(source, m.ucs[i]) }
+		key = source.j
+	}
+	// The CIE2000 bound only holds for lightness within the sRGB range.
+	if m.sorted != nil && (m.method != CIE2000 || color.l >= 0 && color.l <= 100) {
+		return m.sorted.closest(key, m.keyScale(), distance)
+	}
+	best := 0
+	bestDistance := math.Inf(1)
+	for i := range m.lab {
+		deltaE := distance(i)
 		if deltaE < bestDistance {
-			bestIndex = i
+			best = i
 			bestDistance = deltaE
 		}
 	}
-	return bestIndex
+	return best
+}
+
+// Whether index is one of the entries of the matcher.
+func (m matcher) allows(index uint8) bool {
+	for _, i := range m.indices {
+		if i == index {
+			return true
+		}
+	}
+	return false
+}
+
+// Distance between two colors using one of the CIELAB based methods.
+func labDistance(c1 cielab, c2 cielab, method Method) float64 {
+	switch method {
+	case CIE76:
+		return cie76distance(c1, c2)
+	case CIE94:
+		return cie94distance(c1, c2)
+	case CIE2000:
+		return cie2000distance(c1, c2)
+	case CAM16UCS:
+		return cam16ucsDistance(convertCIELABtoCAM16UCS(c1), convertCIELABtoCAM16UCS(c2))
+	}
+	return 0
 }
 
 func rgbDistance(color1 color.RGBA, color2 color.RGBA) float64 {
@@ -192,32 +870,25 @@ func rgbDistance(color1 color.RGBA, color2 color.RGBA) float64 {
 		math.Pow(float64(color1.B)-float64(color2.B), 2)
 }
 
-func convertRGBAtoXYZ(rgba color.RGBA) xyz {
-	r := float64(rgba.R) / 255.0
-	g := float64(rgba.G) / 255.0
-	b := float64(rgba.B) / 255.0
-
-	if r > 0.04045 {
-		r = math.Pow((r+0.055)/1.055, 2.4)
-	} else {
-		r = r / 12.92
-	}
-
-	if g > 0.04045 {
-		g = math.Pow((g+0.055)/1.055, 2.4)
-	} else {
-		g = g / 12.92
-	}
-
-	if b > 0.04045 {
-		b = math.Pow((b+0.055)/1.055, 2.4)
-	} else {
-		b = b / 12.92
+// Linear sRGB channel values scaled to 0..100, indexed by the 8-bit value.
+// Converting every source pixel makes this the hottest code of a conversion.
+var linearChannel = func() (table [256]float64) {
+	for i := range table {
+		v := float64(i) / 255.0
+		if v > 0.04045 {
+			v = math.Pow((v+0.055)/1.055, 2.4)
+		} else {
+			v = v / 12.92
+		}
+		table[i] = v * 100.0
 	}
+	return table
+}()
 
-	r *= 100.0
-	g *= 100.0
-	b *= 100.0
+func convertRGBAtoXYZ(rgba color.RGBA) xyz {
+	r := linearChannel[rgba.R]
+	g := linearChannel[rgba.G]
+	b := linearChannel[rgba.B]
 
 	return xyz{
 		x: 0.4124564*r + 0.3575761*g + 0.1804375*b,
@@ -233,25 +904,84 @@ func convertRGBAtoCIELAB(rgba color.RGBA) cielab {
 	Yn := 100.0
 	Zn := 108.883
 
+	// Cube root, replaced near black by a line with slope 841/108 =
+	// 1/(3*(6/29)^2) and offset 4/29 that meets it with equal slope at
+	// labEpsilon, as in the CIE definition. sRGB never gives negative XYZ,
+	// so there is nothing to clamp.
 	f := func(t float64) float64 {
-		if t > math.Pow(24./116., 3.) {
+		if t > labEpsilon {
 			return math.Pow(t, 1./3.)
 		}
 		return (841./108.)*t + 16./116.
 	}
 
+	fy := f(xyz.y / Yn)
 	return cielab{
-		l: 116.*f(xyz.y/Yn) - 16.,
-		a: 500. * (f(xyz.x/Xn) - f(xyz.y/Yn)),
-		b: 200. * (f(xyz.y/Yn) - f(xyz.z/Zn)),
+		l: 116.*fy - 16.,
+		a: 500. * (f(xyz.x/Xn) - fy),
+		b: 200. * (fy - f(xyz.z/Zn)),
+	}
+}
+
+// Where the linear segment of CIELAB ends, (6/29)^3 = (24/116)^3.
+var labEpsilon = math.Pow(24./116., 3.)
+
+// Inverse of convertRGBAtoCIELAB. Colors outside of sRGB are clamped.
+func convertCIELABtoRGBA(lab cielab) color.RGBA {
+	return convertXYZtoRGBA(convertCIELABtoXYZ(lab))
+}
+
+func convertCIELABtoXYZ(lab cielab) xyz {
+	Xn := 95.047
+	Yn := 100.0
+	Zn := 108.883
+
+	finv := func(t float64) float64 {
+		if t > 24./116. {
+			return t * t * t
+		}
+		return (108. / 841.) * (t - 16./116.)
+	}
+
+	fy := (lab.l + 16.) / 116.
+	return xyz{
+		x: Xn * finv(fy+lab.a/500.),
+		y: Yn * finv(fy),
+		z: Zn * finv(fy-lab.b/200.),
+	}
+}
+
+func convertXYZtoRGBA(c xyz) color.RGBA {
+	x := c.x / 100.0
+	y := c.y / 100.0
+	z := c.z / 100.0
+
+	gamma := func(v float64) uint8 {
+		if v > 0.0031308 {
+			v = 1.055*math.Pow(v, 1./2.4) - 0.055
+		} else {
+			v = 12.92 * v
+		}
+		return uint8(math.Round(255. * math.Max(0, math.Min(1, v))))
+	}
+
+	return color.RGBA{
+		gamma(3.2404542*x - 1.5371385*y - 0.4985314*z),
+		gamma(-0.9692660*x + 1.8760108*y + 0.0415560*z),
+		gamma(0.0556434*x - 0.2040259*y + 1.0572252*z),
+		255,
 	}
 }
 
 func cie76distance(c1 cielab, c2 cielab) float64 {
-	return math.Pow(c2.l-c1.l, 2.0) + math.Pow(c2.a-c1.a, 2.0) + math.Pow(c2.b-c2.b, 2.0)
+	return math.Pow(c2.l-c1.l, 2.0) + math.Pow(c2.a-c1.a, 2.0) + math.Pow(c2.b-c1.b, 2.0)
 }
 
 func cie94distance(col1 cielab, col2 cielab) float64 {
+	return weightedCIE94(col1, col2, labWeights{1., 1.})
+}
+
+func weightedCIE94(col1 cielab, col2 cielab, weights labWeights) float64 {
 	xC1 := math.Sqrt(col1.a*col1.a + col1.b*col1.b)
 	xC2 := math.Sqrt(col2.a*col2.a + col2.b*col2.b)
 	xDL := col2.l - col1.l
@@ -268,18 +998,27 @@ func cie94distance(col1 cielab, col2 cielab) float64 {
 	xSC := 1. + (0.045 * xC1)
 	xSH := 1. + (0.015 * xC1)
 
-	xDL /= 1.
-	xDC /= 1. * xSC
+	xDL *= weights.l
+	xDC = xDC * weights.c / xSC
 	xDH /= 1. * xSH
 
 	return xDL*xDL + xDC*xDC + xDH*xDH
 }
 
+// Hue angle in degrees in the range [0, 360).
 func cielab2hue(a, b float64) float64 {
-	return math.Atan2(b, a) * rad2deg
+	h := math.Atan2(b, a) * rad2deg
+	if h < 0 {
+		h += 360.
+	}
+	return h
 }
 
 func cie2000distance(col1 cielab, col2 cielab) float64 {
+	return weightedCIE2000(col1, col2, labWeights{1., 1.})
+}
+
+func weightedCIE2000(col1 cielab, col2 cielab, weights labWeights) float64 {
 	xC1 := math.Sqrt(col1.a*col1.a + col1.b*col1.b)
 	xC2 := math.Sqrt(col2.a*col2.a + col2.b*col2.b)
 	xCX := (xC1 + xC2) / 2.
@@ -290,10 +1029,18 @@ func cie2000distance(col1 cielab, col2 cielab) float64 {
 	xNN = (1. + xGX) * col2.a
 	xC2 = math.Sqrt(xNN*xNN + col2.b*col2.b)
 	xH2 := cielab2hue(xNN, col2.b)
+	// Test every chroma on its own, since a product of a tiny and a large
+	// chroma says nothing about whether either color has a hue.
+	if xC1 < neutralChroma {
+		xC1, xH1 = 0., 0.
+	}
+	if xC2 < neutralChroma {
+		xC2, xH2 = 0., 0.
+	}
 	xDL := col2.l - col1.l
 	xDC := xC2 - xC1
 	var xDH float64
-	if almostZero(xC1 * xC2) {
+	if xC1*xC2 == 0 {
 		xDH = 0.
 	} else {
 		xNN = xH2 - xH1 // round to 12 decimal places???
@@ -311,7 +1058,7 @@ func cie2000distance(col1 cielab, col2 cielab) float64 {
 	xLX := (col1.l + col2.l) / 2.
 	xCY := (xC1 + xC2) / 2.
 	var xHX float64
-	if almostZero(xC1 * xC2) {
+	if xC1*xC2 == 0 {
 		xHX = xH1 + xH2
 	} else {
 		xNN = math.Abs(xH1 - xH2) // round to 12 decimal places???
@@ -336,8 +1083,8 @@ func cie2000distance(col1 cielab, col2 cielab) float64 {
 	xSC := 1. + 0.045*xCY
 	xSH := 1. + 0.015*xCY*xTX
 	xRT := -math.Sin(deg2rad*2.*xPH) * xRC
-	xDL /= xSL
-	xDC /= xSC
+	xDL = xDL * weights.l / xSL
+	xDC = xDC * weights.c / xSC
 	xDH /= xSH
 
 	return xDL*xDL + xDC*xDC + xDH*xDH + xRT*xDC*xDH
@@ -1,8 +1,11 @@
 package c64image
 
 import (
+	"bytes"
+	"image"
 	"image/color"
 	"math"
+	"runtime"
 	"testing"
 )
 
@@ -16,3 +19,328 @@ func TestColorDistance(t *testing.T) {
 		t.Errorf("color distance broken, got %v but expected %v", d, 87500.0)
 	}
 }
+
+func TestAreaWeightedBlocks(t *testing.T) {
+	// One pixel wider than 4 pixels per block, with only the extra column
+	// white. The last block covers 1/4.00625 of it.
+	img := image.NewRGBA(image.Rect(0, 0, 641, 400))
+	fillImage(img, img.Rect, color.RGBA{0, 0, 0, 255})
+	fillImage(img, image.Rect(640, 0, 641, 400), color.RGBA{255, 255, 255, 255})
+
+	grid := sampleBlocks(img, sampling{})
+	last := grid.rgb[grid.width-1]
+	if expected := 255. / 4.00625; math.Abs(float64(last.R)-expected) > 1 {
+		t.Errorf("last block is %v, expected about %v", last.R, expected)
+	}
+
+	// A ramp sampled with drifting block edges still steps evenly.
+	for x := 0; x < 641; x++ {
+		fillImage(img, image.Rect(x, 0, x+1, 400), color.RGBA{uint8(x * 255 / 640), 0, 0, 255})
+	}
+	grid = sampleBlocks(img, sampling{})
+	for i := 1; i < grid.width; i++ {
+		step := int(grid.rgb[i].R) - int(grid.rgb[i-1].R)
+		if step < 1 || step > 2 {
+			t.Errorf("uneven step %v between blocks %v and %v", step, i-1, i)
+		}
+	}
+}
+
+func TestSmallSourceImage(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 80, 50))
+	fillImage(img, img.Rect, C64Colors[14])
+	out, err := Convert(img, ConvertOptions{Method: CIE2000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < out.Rect.Dy(); y++ {
+		for x := 0; x < out.Rect.Dx(); x++ {
+			if out.RGBAAt(x, y) != C64Colors[14] {
+				t.Fatalf("pixel %v,%v is %v", x, y, out.RGBAAt(x, y))
+			}
+		}
+	}
+}
+
+// No option uses random numbers and parallel work is split independently of
+// the number of workers, so repeated conversions must be identical.
+func TestConvertIsDeterministic(t *testing.T) {
+	img := gradientImage(640, 400)
+	for _, opts := range []ConvertOptions{
+		{Method: CIE2000, Dither: FloydSteinberg},
+		{Method: CIE2000, Dither: BlueNoise, Coherence: 5},
+		{Method: CIE94, Dither: Bayer, MinContrast: 10, MaxScreenColors: 4},
+	} {
+		var outputs [][]byte
+		for _, procs := range []int{1, 4} {
+			previous := runtime.GOMAXPROCS(procs)
+			out, err := Convert(img, opts)
+			runtime.GOMAXPROCS(previous)
+			if err != nil {
+				t.Fatal(err)
+			}
+			outputs = append(outputs, out.Pix)
+		}
+		if !bytes.Equal(outputs[0], outputs[1]) {
+			t.Errorf("%+v: repeated conversions differ", opts)
+		}
+	}
+}
+
+// Sampling and matching run for every block, so they must not allocate.
+func TestBlockWorkDoesNotAllocate(t *testing.T) {
+	img := gradientImage(640, 400)
+	grid := sampleBlocks(img, sampling{})
+	for _, method := range []Method{RGBMethod, CIE76, CIE94, CIE2000, CAM16UCS} {
+		m := fullMatcher(method)
+		allocs := testing.AllocsPerRun(100, func() {
+			lab, rgb := meanBlockColor(img, grid.blockArea(3, 4), sampling{})
+			m.closest(lab, rgb)
+			m.distance(lab, rgb, 7)
+			orderedIndex(grid, m, blueNoiseTexture, 3, 4)
+		})
+		if allocs != 0 {
+			t.Errorf("%v: %v allocations per block", method, allocs)
+		}
+	}
+}
+
+func TestBlockOverlapSmoothsThinLines(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 640, 400))
+	fillImage(img, img.Rect, color.RGBA{0xFF, 0xFF, 0xFF, 0xFF})
+	for y := 0; y < 400; y++ {
+		x0 := 100 + y*7/5
+		img.SetRGBA(x0, y, color.RGBA{0x00, 0x00, 0x00, 0xFF})
+		img.SetRGBA(x0+1, y, color.RGBA{0x00, 0x00, 0x00, 0xFF})
+	}
+
+	// Sum of squared lightness steps between neighboring blocks, which is
+	// lower when the line fades in and out instead of stepping hard.
+	roughness := func(overlap float64) float64 {
+		out, err := Convert(img, ConvertOptions{Method: CIE2000, BlockOverlap: overlap})
+		if err != nil {
+			t.Fatal(err)
+		}
+		total := 0.
+		for y := 0; y < out.Rect.Dy()-1; y++ {
+			for x := 0; x < out.Rect.Dx()-2; x += 2 {
+				l := convertRGBAtoCIELAB(out.RGBAAt(x, y)).l
+				right := convertRGBAtoCIELAB(out.RGBAAt(x+2, y)).l
+				down := convertRGBAtoCIELAB(out.RGBAAt(x, y+1)).l
+				total += (l-right)*(l-right) + (l-down)*(l-down)
+			}
+		}
+		return total
+	}
+
+	plain, overlapped := roughness(1), roughness(2)
+	if overlapped > .8*plain {
+		t.Errorf("roughness %v with overlap, %v without", overlapped, plain)
+	}
+}
+
+func TestBlockOverlapContinuous(t *testing.T) {
+	img := gradientImage(640, 400)
+	// Fractional block edges, so that pixels are partially covered.
+	block := area{10.3, 20.6, 14.1, 22.9}
+	plain, _ := meanBlockColor(img, block, sampling{})
+	barely, _ := meanBlockColor(img, block, sampling{overlap: 1.001})
+	if d := math.Sqrt(cie76distance(plain, barely)); d > .01 {
+		t.Errorf("overlap 1.001 changes the block by delta-E %v", d)
+	}
+
+	// Inside the block every pixel counts fully: a block surrounded by
+	// black keeps its color at any overlap, only diluted by the margin.
+	framed := image.NewRGBA(image.Rect(0, 0, 30, 30))
+	fillImage(framed, image.Rect(10, 10, 20, 20), color.RGBA{0xFF, 0xFF, 0xFF, 0xFF})
+	_, full := meanBlockColor(framed, area{10, 10, 20, 20}, sampling{overlap: 2})
+	// Block area 100, margin weight 4*(10*2.5)+4*(2.5*2.5) = 125.
+	if want := uint8(math.Round(255. * 100. / 225.)); full.R != want {
+		t.Errorf("got %v, want %v", full.R, want)
+	}
+}
+
+func TestLightnessWeight(t *testing.T) {
+	// Dark green is almost equally far from black and from brown, which has
+	// a closer hue but a lightness further away.
+	source := color.RGBA{0x00, 0x22, 0x00, 0xFF}
+	img := image.NewRGBA(image.Rect(0, 0, 640, 400))
+	fillImage(img, img.Rect, source)
+
+	plain, err := Convert(img, ConvertOptions{Method: CIE2000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	weighted, err := Convert(img, ConvertOptions{Method: CIE2000, LightnessWeight: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := convertRGBAtoCIELAB(source).l
+	lightnessError := func(c color.RGBA) float64 { return math.Abs(convertRGBAtoCIELAB(c).l - l) }
+	p, w := plain.RGBAAt(0, 0), weighted.RGBAAt(0, 0)
+	if p == w || lightnessError(w) >= lightnessError(p) {
+		t.Errorf("weighted match %v is not closer in lightness than %v", w, p)
+	}
+}
+
+func TestClosestColorTieGoesToLowestIndex(t *testing.T) {
+	ties := 0
+	for i := range C64Colors {
+		for j := i + 1; j < len(C64Colors); j++ {
+			c1, c2 := C64Colors[i], C64Colors[j]
+			r, g, b := int(c1.R)+int(c2.R), int(c1.G)+int(c2.G), int(c1.B)+int(c2.B)
+			if r%2 != 0 || g%2 != 0 || b%2 != 0 {
+				continue
+			}
+			mid := color.RGBA{uint8(r / 2), uint8(g / 2), uint8(b / 2), 0xFF}
+			d := rgbDistance(mid, c1)
+			if d != rgbDistance(mid, c2) {
+				t.Fatalf("midpoint of %v and %v is not equidistant", i, j)
+			}
+			closer := false
+			for _, c := range C64Colors {
+				closer = closer || rgbDistance(mid, c) < d
+			}
+			if closer {
+				continue
+			}
+			ties++
+			if got := closestC64Color(convertRGBAtoCIELAB(mid), mid, RGBMethod); got != i {
+				t.Errorf("tie between %v and %v resolved to %v", i, j, got)
+			}
+		}
+	}
+	if ties == 0 {
+		t.Fatal("no equidistant palette pair found")
+	}
+}
+
+func TestAlphaWeightedBlocks(t *testing.T) {
+	red := color.RGBA{0xFF, 0x00, 0x00, 0xFF}
+	img := image.NewRGBA(image.Rect(0, 0, 640, 400))
+	// Block 10, 10 covers x 40-44 and y 20-22: a few opaque red pixels,
+	// the rest fully or nearly transparent.
+	img.SetRGBA(40, 20, red)
+	img.SetRGBA(41, 20, red)
+	img.SetRGBA(42, 21, color.RGBA{0x04, 0x00, 0x00, 0x04})
+
+	plain := sampleBlocks(img, sampling{})
+	weighted := sampleBlocks(img, ConvertOptions{AlphaWeighted: true, BackgroundIndex: 6}.sampling())
+	p := 10*plain.width + 10
+	if plain.rgb[p] == red {
+		t.Errorf("unweighted block is pure red")
+	}
+	if weighted.rgb[p] != red {
+		t.Errorf("alpha weighted block is %v, want red", weighted.rgb[p])
+	}
+	if c := weighted.rgb[0]; c != C64Colors[6] {
+		t.Errorf("transparent block is %v, want the background color", c)
+	}
+
+	out, err := Convert(img, ConvertOptions{Method: CIE2000, AlphaWeighted: true, BackgroundIndex: 6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := out.RGBAAt(0, 0); c != C64Colors[6] {
+		t.Errorf("transparent area converted to %v", c)
+	}
+}
+
+func TestCIE2000ReferenceData(t *testing.T) {
+	// Pairs from Sharma, Wu and Dalal, "The CIEDE2000 Color-Difference
+	// Formula", covering neutral colors and the hue averaging branches.
+	for _, test := range []struct {
+		c1, c2 cielab
+		deltaE float64
+	}{
+		{cielab{50., 2.6772, -79.7751}, cielab{50., 0., -82.7485}, 2.0425},
+		{cielab{50., 0., 0.}, cielab{50., -1., 2.}, 2.3669},
+		{cielab{50., -1., 2.}, cielab{50., 0., 0.}, 2.3669},
+		{cielab{50., 2.49, -.001}, cielab{50., -2.49, .0009}, 7.1792},
+		{cielab{50., 2.49, -.001}, cielab{50., -2.49, .0011}, 7.2195},
+		{cielab{50., -.001, 2.49}, cielab{50., .0009, -2.49}, 4.8045},
+		{cielab{50., -.001, 2.49}, cielab{50., .0011, -2.49}, 4.7461},
+		{cielab{50., 2.5, 0.}, cielab{50., 0., -2.5}, 4.3065},
+	} {
+		if d := math.Sqrt(cie2000distance(test.c1, test.c2)); math.Abs(d-test.deltaE) > 1e-4 {
+			t.Errorf("%v to %v: got %.4f, want %.4f", test.c1, test.c2, d, test.deltaE)
+		}
+	}
+}
+
+func TestCIE2000NearNeutral(t *testing.T) {
+	// Grays from sRGB are off neutral by rounding noise. That noise must not
+	// act as a hue, whatever its direction.
+	blue := convertRGBAtoCIELAB(C64Colors[6])
+	neutral := cie2000distance(cielab{40., 0., 0.}, blue)
+	for _, noise := range []cielab{{40., -1e-5, 4e-6}, {40., 1e-12, -1e-12}, {40., 0., 5e-5}} {
+		if d := cie2000distance(noise, blue); math.Abs(d-neutral) > 1e-6*neutral {
+			t.Errorf("%v to blue: got %v, want %v as for neutral gray", noise, d, neutral)
+		}
+	}
+	for _, index := range []int{0, 1, 11, 12, 15} {
+		gray := convertRGBAtoCIELAB(C64Colors[index])
+		if d := cie2000distance(gray, cielab{gray.l, 0., 0.}); d != 0 {
+			t.Errorf("palette gray %d differs from neutral by %v", index, d)
+		}
+	}
+}
+
+func TestScreenConstants(t *testing.T) {
+	if C64Width != 2*C64MulticolorWidth {
+		t.Errorf("C64Width %d is not twice C64MulticolorWidth %d", C64Width, C64MulticolorWidth)
+	}
+	indices, width, err := ConvertIndices(gradientImage(640, 400), ConvertOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if width != C64MulticolorWidth || len(indices) != C64MulticolorWidth*C64Height {
+		t.Errorf("%d indices in rows of %d for a screen-shaped image", len(indices), width)
+	}
+	out := renderIndices(indices, width, len(indices)/width)
+	if size := out.Rect.Size(); size.X != C64Width || size.Y != C64Height {
+		t.Errorf("rendered size %v", size)
+	}
+}
+
+func TestSamplingJitter(t *testing.T) {
+	// A slow horizontal gradient bands into vertical stripes. Without jitter
+	// every row is the same and the band edges are straight grid lines.
+	img := image.NewRGBA(image.Rect(0, 0, 640, 400))
+	for x := 0; x < 640; x++ {
+		v := uint8(0x40 + x*0x60/640)
+		fillImage(img, image.Rect(x, 0, x+1, 400), color.RGBA{v, v, v, 0xFF})
+	}
+	identicalRows := func(opts ConvertOptions) (int, []uint8) {
+		indices, width, err := ConvertIndices(img, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		count := 0
+		for y := width; y < len(indices); y += width {
+			if bytes.Equal(indices[y-width:y], indices[y:y+width]) {
+				count++
+			}
+		}
+		return count, indices
+	}
+
+	plain, _ := identicalRows(ConvertOptions{})
+	jittered, first := identicalRows(ConvertOptions{SamplingJitter: 1, JitterSeed: 1})
+	if plain != C64Height-1 || jittered > plain/2 {
+		t.Errorf("%d identical adjacent rows with jitter, %d without", jittered, plain)
+	}
+
+	if _, again := identicalRows(ConvertOptions{SamplingJitter: 1, JitterSeed: 1}); !bytes.Equal(first, again) {
+		t.Errorf("same seed gave a different result")
+	}
+	if _, other := identicalRows(ConvertOptions{SamplingJitter: 1, JitterSeed: 2}); bytes.Equal(first, other) {
+		t.Errorf("another seed gave the same result")
+	}
+}
+
+func TestWritePNGError(t *testing.T) {
+	if err := writePNG(failingWriter{}, image.NewRGBA(image.Rect(0, 0, 8, 8))); err == nil {
+		t.Errorf("no error for a failed write")
+	}
+}
@@ -0,0 +1,40 @@
+package c64image
+
+import (
+	"image"
+	"path/filepath"
+)
+
+// Save an intermediate image of the conversion to opts.DebugDir, if set, as
+// <method>_<stage>.png, or <name>_<method>_<stage>.png in ConvertDir. Files
+// and methods converted concurrently don't collide. ConvertAutoMethod saves
+// the stages before matching as auto_<stage>.png.
+func (opts ConvertOptions) saveDebugImage(stage string, img *image.RGBA) error {
+	if opts.DebugDir == "" {
+		return nil
+	}
+	method := opts.Method.String()
+	if opts.autoMethod {
+		method = "auto"
+	}
+	name := method + "_" + stage + ".png"
+	if opts.debugName != "" {
+		name = opts.debugName + "_" + name
+	}
+	return SaveImage(img, filepath.Join(opts.DebugDir, name))
+}
+
+// Draw the mean color of every block like renderIndices draws the palette
+// colors.
+func renderBlocks(grid blockGrid) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, grid.width*logicalPixelWidth, grid.height))
+	for j := 0; j < grid.height; j++ {
+		for i := 0; i < grid.width; i++ {
+			c := grid.rgb[j*grid.width+i]
+			for k := 0; k < logicalPixelWidth; k++ {
+				img.SetRGBA(i*logicalPixelWidth+k, j, c)
+			}
+		}
+	}
+	return img
+}
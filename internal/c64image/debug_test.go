@@ -0,0 +1,73 @@
+package c64image
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDebugDir(t *testing.T) {
+	dir := t.TempDir()
+	img := gradientImage(640, 400)
+
+	// Without DebugDir nothing is written, not even to the working directory.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	_, err = Convert(img, ConvertOptions{Method: CIE76})
+	if err := os.Chdir(wd); err != nil {
+		t.Fatal(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("%d files written without DebugDir", len(files))
+	}
+
+	if _, err := Convert(img, ConvertOptions{Method: CIE76, DebugDir: dir}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"CIE76_source.png", "CIE76_blocks.png", "CIE76_result.png"} {
+		loaded, err := LoadImage(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("%v: %v", name, err)
+			continue
+		}
+		if name != "CIE76_source.png" && loaded.Rect.Dx() != C64Width {
+			t.Errorf("%v is %v wide", name, loaded.Rect.Dx())
+		}
+	}
+
+	if _, err := Convert(img, ConvertOptions{DebugDir: filepath.Join(dir, "missing")}); err == nil {
+		t.Errorf("no error for a missing DebugDir")
+	}
+}
+
+func TestDebugDirConvertDir(t *testing.T) {
+	dir := t.TempDir()
+	debug := filepath.Join(dir, "debug")
+	if err := os.Mkdir(debug, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		writeJPEG(t, gradientImage(320, 200), filepath.Join(dir, name+".jpg"))
+	}
+	opts := DirOptions{Options: ConvertOptions{DebugDir: debug}, Methods: []Method{CIE76}, Workers: 3}
+	if err := ConvertDir(dir, opts); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		for _, stage := range []string{"source", "blocks", "result"} {
+			filename := filepath.Join(debug, name+"_CIE76_"+stage+".png")
+			if _, err := LoadImage(filename); err != nil {
+				t.Errorf("%v: %v", filename, err)
+			}
+		}
+	}
+}
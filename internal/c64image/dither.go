@@ -0,0 +1,191 @@
+package c64image
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+type Dither int
+
+const (
+	NoDither Dither = iota
+	// Floyd-Steinberg error diffusion on the mean RGB color of every block.
+	FloydSteinberg
+	// Ordered dither with a 4x4 Bayer matrix.
+	Bayer
+	// Ordered dither with a tiled 16x16 blue-noise texture, which avoids the
+	// regular grid of Bayer.
+	BlueNoise
+	// Ordered dither with ConvertOptions.ThresholdMatrix.
+	Ordered
+)
+
+func (d Dither) String() string {
+	switch d {
+	case NoDither:
+		return "None"
+	case FloydSteinberg:
+		return "FloydSteinberg"
+	case Bayer:
+		return "Bayer"
+	case BlueNoise:
+		return "BlueNoise"
+	case Ordered:
+		return "Ordered"
+	}
+	return fmt.Sprintf("Dither(%d)", int(d))
+}
+
+// ParseDither returns the dither whose String matches name, ignoring case.
+// Ordered is not accepted since its ThresholdMatrix can only be set in code.
+func ParseDither(name string) (Dither, error) {
+	for d := NoDither; d < Ordered; d++ {
+		if strings.EqualFold(d.String(), name) {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown dither %q", name)
+}
+
+// Error diffusion is done in horizontal strips of ditherStripHeight rows that
+// are dithered concurrently. To hide the seams every strip starts dithering
+// ditherOverlap rows above its first row, so that the error has settled when
+// the strip's own rows are reached, and throws those rows away. A larger
+// overlap gives seams closer to a serial dither but repeats more work: with
+// 16 row strips an overlap of 8 rows costs 50% extra. The strip layout only
+// depends on the image size, so the result is the same for any number of
+// CPUs.
+const (
+	ditherStripHeight = 16
+	ditherOverlap     = 8
+)
+
+// Dither blocks to palette indices, stripHeight rows at a time. With
+// chromaOnly only the a* and b* error is diffused.
+func ditherBlocks(grid blockGrid, m matcher, stripHeight int, chromaOnly bool) []uint8 {
+	indices := make([]uint8, len(grid.rgb))
+	strips := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.GOMAXPROCS(0); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for from := range strips {
+				to := from + stripHeight
+				if to > grid.height {
+					to = grid.height
+				}
+				start := from - ditherOverlap
+				if start < 0 {
+					start = 0
+				}
+				if chromaOnly {
+					ditherChromaRows(grid, m, indices, start, from, to)
+				} else {
+					ditherRows(grid, m, indices, start, from, to)
+				}
+			}
+		}()
+	}
+	for from := 0; from < grid.height; from += stripHeight {
+		strips <- from
+	}
+	close(strips)
+	wg.Wait()
+	return indices
+}
+
+// Floyd-Steinberg dither rows start to to with no incoming error, storing
+// indices for rows from and below.
+func ditherRows(grid blockGrid, m matcher, indices []uint8, start, from, to int) {
+	// Error per row is offset by one to avoid bounds checks at the edges.
+	current := make([][3]float64, grid.width+2)
+	next := make([][3]float64, grid.width+2)
+
+	for y := start; y < to; y++ {
+		for x := 0; x < grid.width; x++ {
+			p := y*grid.width + x
+			c := grid.rgb[p]
+			wanted := [3]float64{
+				clampChannel(float64(c.R) + current[x+1][0]),
+				clampChannel(float64(c.G) + current[x+1][1]),
+				clampChannel(float64(c.B) + current[x+1][2]),
+			}
+			adjusted := color.RGBA{
+				uint8(math.Round(wanted[0])),
+				uint8(math.Round(wanted[1])),
+				uint8(math.Round(wanted[2])),
+				255,
+			}
+			ci := m.closest(convertRGBAtoCIELAB(adjusted), adjusted)
+			if y >= from {
+				indices[p] = ci
+			}
+
+			chosen := C64Colors[ci]
+			quantError := [3]float64{
+				wanted[0] - float64(chosen.R),
+				wanted[1] - float64(chosen.G),
+				wanted[2] - float64(chosen.B),
+			}
+			for k, e := range quantError {
+				current[x+2][k] += e * 7. / 16.
+				next[x][k] += e * 3. / 16.
+				next[x+1][k] += e * 5. / 16.
+				next[x+2][k] += e * 1. / 16.
+			}
+		}
+		current, next = next, current
+		for i := range next {
+			next[i] = [3]float64{}
+		}
+	}
+}
+
+// Like ditherRows, but diffuses only the a* and b* error in CIELAB so that
+// lightness is quantized without dither patterns.
+func ditherChromaRows(grid blockGrid, m matcher, indices []uint8, start, from, to int) {
+	current := make([][2]float64, grid.width+2)
+	next := make([][2]float64, grid.width+2)
+
+	for y := start; y < to; y++ {
+		for x := 0; x < grid.width; x++ {
+			p := y*grid.width + x
+			wanted := cielab{
+				l: grid.lab[p].l,
+				a: clampChroma(grid.lab[p].a + current[x+1][0]),
+				b: clampChroma(grid.lab[p].b + current[x+1][1]),
+			}
+			ci := m.closest(wanted, convertCIELABtoRGBA(wanted))
+			if y >= from {
+				indices[p] = ci
+			}
+
+			chosen := convertRGBAtoCIELAB(C64Colors[ci])
+			quantError := [2]float64{wanted.a - chosen.a, wanted.b - chosen.b}
+			for k, e := range quantError {
+				current[x+2][k] += e * 7. / 16.
+				next[x][k] += e * 3. / 16.
+				next[x+1][k] += e * 5. / 16.
+				next[x+2][k] += e * 1. / 16.
+			}
+		}
+		current, next = next, current
+		for i := range next {
+			next[i] = [2]float64{}
+		}
+	}
+}
+
+// Keep accumulated error within the range of sRGB colors.
+func clampChroma(v float64) float64 {
+	return math.Max(-128, math.Min(127, v))
+}
+
+func clampChannel(v float64) float64 {
+	return math.Max(0, math.Min(255, v))
+}
@@ -0,0 +1,160 @@
+package c64image
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func gradientImage(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetRGBA(x, y, color.RGBA{uint8(x * 255 / width), uint8(y * 255 / height), 128, 255})
+		}
+	}
+	return img
+}
+
+func TestParallelDitherMatchesSerial(t *testing.T) {
+	grid := sampleBlocks(gradientImage(640, 400), sampling{})
+	serial := ditherBlocks(grid, fullMatcher(CIE2000), grid.height, false)
+	parallel := ditherBlocks(grid, fullMatcher(CIE2000), ditherStripHeight, false)
+
+	// Compare mean color of 16x16 tiles since the dither pattern itself shifts
+	// slightly at the seams.
+	const tile = 16
+	worst := 0.
+	for ty := 0; ty < grid.height; ty += tile {
+		for tx := 0; tx < grid.width; tx += tile {
+			var sum [3]float64
+			for y := ty; y < ty+tile && y < grid.height; y++ {
+				for x := tx; x < tx+tile && x < grid.width; x++ {
+					s := C64Colors[serial[y*grid.width+x]]
+					p := C64Colors[parallel[y*grid.width+x]]
+					sum[0] += float64(s.R) - float64(p.R)
+					sum[1] += float64(s.G) - float64(p.G)
+					sum[2] += float64(s.B) - float64(p.B)
+				}
+			}
+			for _, d := range sum {
+				worst = math.Max(worst, math.Abs(d)/(tile*tile))
+			}
+		}
+	}
+	if worst > 6 {
+		t.Errorf("tile mean differs by %v channel steps from serial dither", worst)
+	}
+
+	// Error diffusion is chaotic, so the pattern differs pixel by pixel,
+	// but a 4x4 window of it, as seen from a distance, should barely change.
+	same := 0
+	for p := range serial {
+		if serial[p] == parallel[p] {
+			same++
+		}
+	}
+	if share := float64(same) / float64(len(serial)); share < .55 {
+		t.Errorf("only %.0f%% of pixels match the serial dither", 100*share)
+	}
+	const window = 4
+	var windows []float64
+	for wy := 0; wy+window <= grid.height; wy++ {
+		for wx := 0; wx+window <= grid.width; wx++ {
+			var s, p xyz
+			for y := wy; y < wy+window; y++ {
+				for x := wx; x < wx+window; x++ {
+					a := convertRGBAtoXYZ(C64Colors[serial[y*grid.width+x]])
+					b := convertRGBAtoXYZ(C64Colors[parallel[y*grid.width+x]])
+					s.x, s.y, s.z = s.x+a.x, s.y+a.y, s.z+a.z
+					p.x, p.y, p.z = p.x+b.x, p.y+b.y, p.z+b.z
+				}
+			}
+			n := float64(window * window)
+			sLab := convertRGBAtoCIELAB(convertXYZtoRGBA(xyz{s.x / n, s.y / n, s.z / n}))
+			pLab := convertRGBAtoCIELAB(convertXYZtoRGBA(xyz{p.x / n, p.y / n, p.z / n}))
+			windows = append(windows, math.Sqrt(cie2000distance(sLab, pLab)))
+		}
+	}
+	sort.Float64s(windows)
+	if median, p99 := windows[len(windows)/2], windows[len(windows)*99/100]; median > 2 || p99 > 8 {
+		t.Errorf("4x4 windows differ from serial dither by delta-E %.1f (median), %.1f (99th percentile)", median, p99)
+	}
+}
+
+func TestDitherIndependentOfGOMAXPROCS(t *testing.T) {
+	img := gradientImage(640, 400)
+	opts := ConvertOptions{Method: CIE2000, Dither: FloydSteinberg}
+
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+	single, err := Convert(img, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runtime.GOMAXPROCS(8)
+	multi, err := Convert(img, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(single.Pix, multi.Pix) {
+		t.Errorf("dithered output depends on GOMAXPROCS")
+	}
+}
+
+func TestChromaOnlyDither(t *testing.T) {
+	// Number of horizontally adjacent logical pixels with different colors.
+	transitions := func(img *image.RGBA, opts ConvertOptions) int {
+		out, err := Convert(img, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		count := 0
+		for y := 0; y < out.Rect.Dy(); y++ {
+			for x := 2; x < out.Rect.Dx(); x += 2 {
+				if out.RGBAAt(x, y) != out.RGBAAt(x-2, y) {
+					count++
+				}
+			}
+		}
+		return count
+	}
+	plain := ConvertOptions{Method: CIE2000}
+	chroma := ConvertOptions{Method: CIE2000, Dither: FloydSteinberg, ChromaOnlyDither: true}
+
+	// Hue sweep at constant lightness.
+	hues := image.NewRGBA(image.Rect(0, 0, 640, 400))
+	for x := 0; x < 640; x++ {
+		h := float64(x) / 640. * 2. * math.Pi
+		c := convertCIELABtoRGBA(cielab{60., 30. * math.Cos(h), 30. * math.Sin(h)})
+		fillImage(hues, image.Rect(x, 0, x+1, 400), c)
+	}
+	if banded, dithered := transitions(hues, plain), transitions(hues, chroma); dithered < 4*banded {
+		t.Errorf("hue sweep: %d transitions with chroma dither, %d without", dithered, banded)
+	}
+
+	// Lightness ramp at constant (neutral) hue.
+	ramp := image.NewRGBA(image.Rect(0, 0, 640, 400))
+	for x := 0; x < 640; x++ {
+		v := uint8(x * 255 / 640)
+		fillImage(ramp, image.Rect(x, 0, x+1, 400), color.RGBA{v, v, v, 0xFF})
+	}
+	if banded, dithered := transitions(ramp, plain), transitions(ramp, chroma); dithered != banded {
+		t.Errorf("lightness ramp: %d transitions with chroma dither, %d without", dithered, banded)
+	}
+}
+
+func TestParseDither(t *testing.T) {
+	for d := NoDither; d < Ordered; d++ {
+		if parsed, err := ParseDither(strings.ToLower(d.String())); err != nil || parsed != d {
+			t.Errorf("%v: got %v, %v", d, parsed, err)
+		}
+	}
+	if _, err := ParseDither("Ordered"); err == nil {
+		t.Errorf("parsed Ordered, which needs a ThresholdMatrix")
+	}
+}
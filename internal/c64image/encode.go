@@ -0,0 +1,46 @@
+package c64image
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/png"
+	"strings"
+)
+
+var UnsupportedFormatError = fmt.Errorf("unsupported format")
+
+// ConvertToBytes converts img and returns the result encoded as format:
+// "png", "gif" (with the C64 palette) or "svg" (see SaveSVG).
+func ConvertToBytes(img *image.RGBA, format string, opts ConvertOptions) ([]byte, error) {
+	var buf bytes.Buffer
+	var encode func(*image.RGBA) error
+	switch strings.ToLower(format) {
+	case "png":
+		encode = func(result *image.RGBA) error { return png.Encode(&buf, result) }
+	case "gif":
+		encode = func(result *image.RGBA) error {
+			palette := c64Palette()
+			paletted := image.NewPaletted(result.Rect, palette)
+			for i := range paletted.Pix {
+				x, y := i%result.Rect.Dx(), i/result.Rect.Dx()
+				paletted.Pix[i] = uint8(palette.Index(result.RGBAAt(result.Rect.Min.X+x, result.Rect.Min.Y+y)))
+			}
+			return gif.Encode(&buf, paletted, nil)
+		}
+	case "svg":
+		encode = func(result *image.RGBA) error { return SaveSVG(result, &buf) }
+	default:
+		return nil, fmt.Errorf("%w: %q", UnsupportedFormatError, format)
+	}
+
+	result, err := Convert(img, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := encode(result); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,50 @@
+package c64image
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"testing"
+)
+
+func TestConvertToBytes(t *testing.T) {
+	img := gradientImage(640, 400)
+	palette := make(map[color.RGBA]bool)
+	for _, c := range C64Colors {
+		palette[c] = true
+	}
+
+	for _, format := range []string{"png", "gif"} {
+		data, err := ConvertToBytes(img, format, ConvertOptions{Method: CIE2000})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded image.Image
+		if format == "png" {
+			decoded, err = png.Decode(bytes.NewReader(data))
+		} else {
+			decoded, err = gif.Decode(bytes.NewReader(data))
+		}
+		if err != nil {
+			t.Fatalf("%v: %v", format, err)
+		}
+		bounds := decoded.Bounds()
+		if bounds.Dx() != C64Width || bounds.Dy() != C64Height {
+			t.Errorf("%v: decoded size %v", format, bounds.Size())
+		}
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				if c := color.RGBAModel.Convert(decoded.At(x, y)).(color.RGBA); !palette[c] {
+					t.Fatalf("%v: pixel %v,%v is %v, not a palette color", format, x, y, c)
+				}
+			}
+		}
+	}
+
+	if _, err := ConvertToBytes(img, "koa", ConvertOptions{}); !errors.Is(err, UnsupportedFormatError) {
+		t.Errorf("got %v for an unknown format", err)
+	}
+}
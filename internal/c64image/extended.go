@@ -0,0 +1,62 @@
+package c64image
+
+import "image/color"
+
+// A 2x2 checkerboard of two palette colors. From a distance it looks like
+// the mean of both in linear light. Entries with a == b are solid colors.
+type paletteMix struct {
+	a, b uint8
+}
+
+// Every mix of two of the given palette indices, solid colors included.
+// With the full palette these are 16 solid colors and 120 mixed pairs.
+func paletteMixes(indices []uint8) ([]paletteMix, []color.RGBA) {
+	var mixes []paletteMix
+	var colors []color.RGBA
+	for i, a := range indices {
+		for _, b := range indices[i:] {
+			ca, cb := convertRGBAtoXYZ(C64Colors[a]), convertRGBAtoXYZ(C64Colors[b])
+			mixes = append(mixes, paletteMix{a, b})
+			colors = append(colors, convertXYZtoRGBA(xyz{(ca.x + cb.x) / 2., (ca.y + cb.y) / 2., (ca.z + cb.z) / 2.}))
+		}
+	}
+	return mixes, colors
+}
+
+// Match every 2x2 group of blocks against the mixes of the entries of m and
+// fill it with the pattern of the closest mix. The first color of the mix
+// goes to the top left and bottom right block.
+func matchExtended(grid blockGrid, m matcher) []uint8 {
+	mixes, colors := paletteMixes(m.indices)
+	extended := colorMatcher(m.method, colors)
+	extended.weights = m.weights
+
+	indices := make([]uint8, len(grid.lab))
+	for j := 0; j < grid.height; j += 2 {
+		for i := 0; i < grid.width; i += 2 {
+			// Mean of the group in linear light, like the mixes.
+			var sum xyz
+			n := 0.
+			for y := j; y < j+2 && y < grid.height; y++ {
+				for x := i; x < i+2 && x < grid.width; x++ {
+					c := convertRGBAtoXYZ(grid.rgb[y*grid.width+x])
+					sum.x, sum.y, sum.z = sum.x+c.x, sum.y+c.y, sum.z+c.z
+					n++
+				}
+			}
+			mean := convertXYZtoRGBA(xyz{sum.x / n, sum.y / n, sum.z / n})
+			mix := mixes[extended.closestEntry(convertRGBAtoCIELAB(mean), mean)]
+
+			for y := j; y < j+2 && y < grid.height; y++ {
+				for x := i; x < i+2 && x < grid.width; x++ {
+					if (x-i+y-j)%2 == 0 {
+						indices[y*grid.width+x] = mix.a
+					} else {
+						indices[y*grid.width+x] = mix.b
+					}
+				}
+			}
+		}
+	}
+	return indices
+}
@@ -0,0 +1,54 @@
+package c64image
+
+import (
+	"image"
+	"testing"
+)
+
+func TestExtendedPalette(t *testing.T) {
+	// Mix of white (1) and red (2).
+	_, colors := paletteMixes([]uint8{1, 2})
+	mix := colors[1]
+
+	img := image.NewRGBA(image.Rect(0, 0, 320, 200))
+	fillImage(img, img.Rect, mix)
+	for _, method := range []Method{RGBMethod, CIE76, CIE94, CIE2000, CAM16UCS} {
+		out, err := Convert(img, ConvertOptions{Method: method, ExtendedPalette: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Logical pixels are two pixels wide.
+		for y := 0; y < 200; y++ {
+			for x := 0; x < 320; x++ {
+				want := C64Colors[1]
+				if (x/2+y)%2 == 1 {
+					want = C64Colors[2]
+				}
+				if got := out.RGBAAt(x, y); got != want {
+					t.Fatalf("%v: pixel %d,%d is %v, want %v", method, x, y, got, want)
+				}
+			}
+		}
+	}
+
+	// Any source gives base colors only.
+	out, err := Convert(gradientImage(640, 400), ConvertOptions{Method: CIE2000, ExtendedPalette: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < out.Rect.Dy(); y++ {
+		for x := 0; x < out.Rect.Dx(); x++ {
+			found := false
+			for _, c := range C64Colors {
+				found = found || out.RGBAAt(x, y) == c
+			}
+			if !found {
+				t.Fatalf("pixel %d,%d is %v, not a palette color", x, y, out.RGBAAt(x, y))
+			}
+		}
+	}
+
+	if _, err := Convert(img, ConvertOptions{ExtendedPalette: true, Dither: Bayer}); err == nil {
+		t.Errorf("ExtendedPalette with Bayer dither accepted")
+	}
+}
@@ -0,0 +1,43 @@
+package c64image
+
+import (
+	"image"
+	"math"
+)
+
+// ConvertFlicker converts img to two frames meant to be shown alternately so
+// that the eye sees the average of both in linear light, like the mixes of
+// ExtendedPalette. Every block gets the pair of palette colors whose average
+// is closest to the source, with the lower palette index in the first frame.
+// Only the Method option is used.
+func ConvertFlicker(img *image.RGBA, opts ConvertOptions) (*image.RGBA, *image.RGBA, error) {
+	if err := opts.validate(); err != nil {
+		return nil, nil, err
+	}
+
+	mixes, colors := paletteMixes(fullMatcher(opts.Method).indices)
+	labs := make([]cielab, len(colors))
+	for i, c := range colors {
+		labs[i] = convertRGBAtoCIELAB(c)
+	}
+
+	grid := sampleBlocks(img, sampling{})
+	first := make([]uint8, len(grid.lab))
+	second := make([]uint8, len(grid.lab))
+	for p := range grid.lab {
+		bestDistance := math.Inf(1)
+		for i, mix := range mixes {
+			var d float64
+			if opts.Method == RGBMethod {
+				d = rgbDistance(grid.rgb[p], colors[i])
+			} else {
+				d = labDistance(grid.lab[p], labs[i], opts.Method)
+			}
+			if d < bestDistance {
+				first[p], second[p] = mix.a, mix.b
+				bestDistance = d
+			}
+		}
+	}
+	return renderIndices(first, grid.width, grid.height), renderIndices(second, grid.width, grid.height), nil
+}
@@ -0,0 +1,26 @@
+package c64image
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestConvertFlickerUsesBothEndpoints(t *testing.T) {
+	// Between dark grey (0x43) and light grey (0x95) in linear light, while
+	// grey (0x6B) and its mixes with both are at least 10 steps away. The
+	// mean of the sRGB values would be 0x6C, right next to grey.
+	img := image.NewRGBA(image.Rect(0, 0, 640, 400))
+	fillImage(img, img.Rect, color.RGBA{0x75, 0x75, 0x75, 0xFF})
+
+	for _, method := range []Method{RGBMethod, CIE76, CIE94, CIE2000} {
+		frame1, frame2, err := ConvertFlicker(img, ConvertOptions{Method: method})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if frame1.RGBAAt(10, 10) != C64Colors[11] || frame2.RGBAAt(10, 10) != C64Colors[15] {
+			t.Errorf("%v: got %v and %v, expected dark and light grey",
+				method, frame1.RGBAAt(10, 10), frame2.RGBAAt(10, 10))
+		}
+	}
+}
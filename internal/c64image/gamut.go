@@ -0,0 +1,82 @@
+package c64image
+
+import (
+	"image/color"
+	"math"
+)
+
+// Convex hull of the palette in CIELAB. Dithering mixes palette colors, so
+// colors within the hull can be approximated and colors beyond it can't.
+// Mixing is not exactly linear in CIELAB, but close enough for a limit.
+type chromaGamut struct {
+	facets []gamutFacet
+}
+
+// Plane of a face of the hull, n·x = d with n pointing outwards.
+type gamutFacet struct {
+	n [3]float64
+	d float64
+}
+
+var c64Gamut = newChromaGamut(C64Colors[:])
+
+func newChromaGamut(palette []color.RGBA) chromaGamut {
+	points := make([][3]float64, len(palette))
+	for i, c := range palette {
+		lab := convertRGBAtoCIELAB(c)
+		points[i] = [3]float64{lab.l, lab.a, lab.b}
+	}
+	sub := func(a, b [3]float64) [3]float64 { return [3]float64{a[0] - b[0], a[1] - b[1], a[2] - b[2]} }
+	dot := func(a, b [3]float64) float64 { return a[0]*b[0] + a[1]*b[1] + a[2]*b[2] }
+
+	// A palette this small allows trying every plane through three colors;
+	// it is a face if no color lies outside of it.
+	const epsilon = 1e-9
+	var g chromaGamut
+	for i := range points {
+		for j := i + 1; j < len(points); j++ {
+			for k := j + 1; k < len(points); k++ {
+				u, v := sub(points[j], points[i]), sub(points[k], points[i])
+				n := [3]float64{u[1]*v[2] - u[2]*v[1], u[2]*v[0] - u[0]*v[2], u[0]*v[1] - u[1]*v[0]}
+				length := math.Sqrt(dot(n, n))
+				if length < epsilon {
+					continue
+				}
+				n = [3]float64{n[0] / length, n[1] / length, n[2] / length}
+				above, below := false, false
+				for _, p := range points {
+					side := dot(n, sub(p, points[i]))
+					above = above || side > epsilon
+					below = below || side < -epsilon
+				}
+				if above && below {
+					continue
+				}
+				if above {
+					n = [3]float64{-n[0], -n[1], -n[2]}
+				}
+				g.facets = append(g.facets, gamutFacet{n, dot(n, points[i])})
+			}
+		}
+	}
+	return g
+}
+
+// Reduce the chroma of lab to the edge of the gamut, keeping lightness and
+// hue. Colors within the gamut are returned unchanged.
+func (g chromaGamut) clamp(lab cielab) cielab {
+	// Largest t for which (l, t*a, t*b) is on the inner side of every face.
+	// Gray (l, 0, 0) is within the gamut between black and white.
+	limit := 1.
+	for _, f := range g.facets {
+		outwards := f.n[1]*lab.a + f.n[2]*lab.b
+		if outwards <= 0 {
+			continue
+		}
+		t := (f.d - f.n[0]*lab.l) / outwards
+		if t < limit {
+			limit = math.Max(0, t)
+		}
+	}
+	return cielab{lab.l, lab.a * limit, lab.b * limit}
+}
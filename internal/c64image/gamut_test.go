@@ -0,0 +1,60 @@
+package c64image
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestChromaGamut(t *testing.T) {
+	// The palette itself lies within its gamut.
+	for i, c := range C64Colors {
+		lab := convertRGBAtoCIELAB(c)
+		if clamped := c64Gamut.clamp(lab); math.Abs(clamped.a-lab.a) > 1e-9 || math.Abs(clamped.b-lab.b) > 1e-9 {
+			t.Errorf("palette color %d clamped from %v to %v", i, lab, clamped)
+		}
+	}
+
+	magenta := convertRGBAtoCIELAB(color.RGBA{0xFF, 0x00, 0xFF, 0xFF})
+	clamped := c64Gamut.clamp(magenta)
+	chroma, limit := math.Hypot(magenta.a, magenta.b), math.Hypot(clamped.a, clamped.b)
+	if limit >= chroma/2 || limit < 10 {
+		t.Errorf("magenta chroma %v clamped to %v", chroma, limit)
+	}
+	if clamped.l != magenta.l || math.Abs(cielab2hue(clamped.a, clamped.b)-cielab2hue(magenta.a, magenta.b)) > 1e-9 {
+		t.Errorf("clamping changed lightness or hue: %v to %v", magenta, clamped)
+	}
+	// The limit is the edge: anything beyond it is clamped back to it.
+	beyond := cielab{clamped.l, clamped.a * 1.01, clamped.b * 1.01}
+	if again := c64Gamut.clamp(beyond); math.Abs(again.a-clamped.a) > 1e-9 || math.Abs(again.b-clamped.b) > 1e-9 {
+		t.Errorf("%v beyond the edge clamped to %v, want %v", beyond, again, clamped)
+	}
+}
+
+func TestClampChroma(t *testing.T) {
+	// Unreachable chroma piles up as dither error that can never be paid
+	// off, which drags the whole area to one color. Clamped, the dither
+	// gets the lightness right.
+	magenta := color.RGBA{0xFF, 0x00, 0xFF, 0xFF}
+	img := image.NewRGBA(image.Rect(0, 0, 320, 200))
+	fillImage(img, img.Rect, magenta)
+	lightnessError := func(clamp bool) float64 {
+		out, err := Convert(img, ConvertOptions{Method: CIE2000, Dither: FloydSteinberg, ClampChroma: clamp})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var sum xyz
+		for y := 0; y < 200; y++ {
+			for x := 0; x < 320; x++ {
+				c := convertRGBAtoXYZ(out.RGBAAt(x, y))
+				sum.x, sum.y, sum.z = sum.x+c.x, sum.y+c.y, sum.z+c.z
+			}
+		}
+		mean := convertXYZtoRGBA(xyz{sum.x / 64000., sum.y / 64000., sum.z / 64000.})
+		return math.Abs(convertRGBAtoCIELAB(mean).l - convertRGBAtoCIELAB(magenta).l)
+	}
+	if unclamped, clamped := lightnessError(false), lightnessError(true); clamped > unclamped/2 {
+		t.Errorf("mean lightness off by %v with ClampChroma, %v without", clamped, unclamped)
+	}
+}
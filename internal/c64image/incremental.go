@@ -0,0 +1,108 @@
+package c64image
+
+import "image"
+
+// Converter converts images with fixed options and keeps the latest result,
+// so that an edited image can be reconverted with ConvertDirty and frames of
+// an animation can be kept stable with ConvertFrame.
+type Converter struct {
+	Options ConvertOptions
+
+	bounds  image.Rectangle
+	grid    blockGrid
+	indices []uint8
+
+	// Source color of every block when ConvertFrame last chose its index.
+	reference []cielab
+}
+
+// Convert img and keep the result for ConvertDirty.
+func (c *Converter) Convert(img *image.RGBA) (*image.RGBA, error) {
+	grid, indices, err := convertBlocks(img, c.Options, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.bounds, c.grid, c.indices, c.reference = img.Rect, grid, indices, nil
+	return renderIndices(indices, grid.width, grid.height), nil
+}
+
+// ConvertFrame converts img as the next frame of an animation. Blocks whose
+// source color moved less than Options.TemporalTolerance since their palette
+// color was chosen keep that color, so that dither patterns in static areas
+// do not flicker between frames. The first frame, a frame of a different
+// size, frames after Convert or ConvertDirty and options with passes over
+// the whole image are converted as by Convert.
+func (c *Converter) ConvertFrame(img *image.RGBA) (*image.RGBA, error) {
+	previous, reference := c.indices, c.reference
+	if img.Rect != c.bounds || !c.Options.keepsFrameBlocks() {
+		previous, reference = nil, nil
+	}
+	grid, indices, err := convertBlocks(img, c.Options, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := c.Options.TemporalTolerance * c.Options.TemporalTolerance
+	current := make([]cielab, len(grid.lab))
+	for p := range indices {
+		current[p] = grid.lab[p]
+		if reference != nil && cie2000distance(reference[p], grid.lab[p]) < limit {
+			indices[p], current[p] = previous[p], reference[p]
+		}
+	}
+	c.bounds, c.grid, c.indices, c.reference = img.Rect, grid, indices, current
+	return renderIndices(indices, grid.width, grid.height), nil
+}
+
+// ConvertDirty reconverts img where dirty covers every pixel changed since
+// the previous conversion, only recomputing blocks overlapping dirty. The
+// result equals that of Convert. Options where blocks affect each other
+// (FloydSteinberg, Coherence, MinContrast, MaxScreenColors, AutoLevels and
+// TrimBars) and a first call or a changed image size fall back to a full
+// conversion.
+func (c *Converter) ConvertDirty(img *image.RGBA, dirty image.Rectangle) (*image.RGBA, error) {
+	if c.indices == nil || img.Rect != c.bounds || !c.Options.blockLocal() {
+		return c.Convert(img)
+	}
+	img = c.Options.cropSource(img)
+	c.reference = nil
+
+	grid := c.grid
+	m := c.Options.matcher()
+	for j := 0; j < grid.height; j++ {
+		for i := 0; i < grid.width; i++ {
+			block := grid.blockArea(i, j)
+			if !block.expand(grid.sampling.overlap).bounds().Add(img.Rect.Min).Overlaps(dirty) {
+				continue
+			}
+			p := j*grid.width + i
+			grid.lab[p], grid.rgb[p] = meanBlockColor(img, block, grid.sampling)
+			c.indices[p] = snapIndex(grid.rgb[p], localIndex(grid, c.Options, m, i, j), c.Options.SnapPrimaries, m)
+		}
+	}
+	return renderIndices(c.indices, grid.width, grid.height), nil
+}
+
+// Whether ConvertFrame may keep blocks from the previous frame. Kept colors
+// are merged after matching, so they could fall outside the MaxScreenColors
+// subset or undo the passes that look at the whole image.
+func (opts ConvertOptions) keepsFrameBlocks() bool {
+	return opts.MaxScreenColors == 0 && opts.Coherence == 0 && opts.MinContrast == 0 &&
+		opts.PreserveBrightness == 0 && !opts.ExtendedPalette
+}
+
+// Whether the palette index of a block only depends on the block itself.
+func (opts ConvertOptions) blockLocal() bool {
+	return opts.Dither != FloydSteinberg && opts.Coherence == 0 && opts.MinContrast == 0 &&
+		opts.MaxScreenColors == 0 && !opts.AutoLevels && !opts.TrimBars && !opts.ExtendedPalette &&
+		opts.DownscaleFilter == Box && opts.PreserveBrightness == 0
+}
+
+// Palette index of block i, j for options where blocks are independent.
+func localIndex(grid blockGrid, opts ConvertOptions, m matcher, i, j int) uint8 {
+	if matrix := opts.thresholdMatrix(); matrix != nil {
+		return orderedIndex(grid, m, matrix, i, j)
+	}
+	p := j*grid.width + i
+	return m.closest(grid.lab[p], grid.rgb[p])
+}
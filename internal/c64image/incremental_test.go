@@ -0,0 +1,111 @@
+package c64image
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestConvertDirty(t *testing.T) {
+	for _, dither := range []Dither{NoDither, BlueNoise, FloydSteinberg} {
+		opts := ConvertOptions{Method: CIE94, Dither: dither}
+		converter := Converter{Options: opts}
+		img := gradientImage(640, 400)
+		if _, err := converter.Convert(img); err != nil {
+			t.Fatal(err)
+		}
+
+		dirty := image.Rect(101, 53, 133, 71)
+		fillImage(img, dirty, color.RGBA{0xE0, 0x20, 0x40, 0xFF})
+		incremental, err := converter.ConvertDirty(img, dirty)
+		if err != nil {
+			t.Fatal(err)
+		}
+		full, err := Convert(img, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(incremental.Pix, full.Pix) {
+			t.Errorf("dither %v: incremental conversion differs from full conversion", dither)
+		}
+	}
+}
+
+func TestConvertFrameKeepsStaticAreas(t *testing.T) {
+	first := gradientImage(640, 400)
+	// The second frame has slight noise everywhere and a changed area.
+	second := gradientImage(640, 400)
+	for i := 0; i < len(second.Pix); i += 4 * 7 {
+		if second.Pix[i] < 0xFF {
+			second.Pix[i]++
+		}
+	}
+	moved := image.Rect(300, 100, 400, 200)
+	fillImage(second, moved, color.RGBA{0xE0, 0x20, 0x40, 0xFF})
+
+	// Pixels outside moved that differ between the converted frames.
+	flicker := func(tolerance float64) int {
+		converter := Converter{Options: ConvertOptions{Method: CIE2000, Dither: FloydSteinberg, TemporalTolerance: tolerance}}
+		a, err := converter.ConvertFrame(first)
+		if err != nil {
+			t.Fatal(err)
+		}
+		again, _ := converter.ConvertFrame(first)
+		if !bytes.Equal(a.Pix, again.Pix) {
+			t.Errorf("tolerance %v: identical frames converted differently", tolerance)
+		}
+		b, err := converter.ConvertFrame(second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Output is 320 wide for a 640 wide source.
+		outMoved := image.Rect(moved.Min.X/2, moved.Min.Y/2, moved.Max.X/2, moved.Max.Y/2)
+		count := 0
+		for y := 0; y < a.Rect.Dy(); y++ {
+			for x := 0; x < a.Rect.Dx(); x++ {
+				if !image.Pt(x, y).In(outMoved) && a.RGBAAt(x, y) != b.RGBAAt(x, y) {
+					count++
+				}
+			}
+		}
+		return count
+	}
+	if independent := flicker(0); independent == 0 {
+		t.Errorf("expected independently dithered frames to differ")
+	}
+	if stable := flicker(2); stable != 0 {
+		t.Errorf("%d pixels changed outside the moved area", stable)
+	}
+}
+
+func TestConvertFrameMaxScreenColors(t *testing.T) {
+	first := gradientImage(640, 400)
+	// The second frame adds saturated green, which changes the best subset
+	// of screen colors.
+	second := gradientImage(640, 400)
+	fillImage(second, image.Rect(0, 0, 320, 400), color.RGBA{0x20, 0xE0, 0x20, 0xFF})
+
+	opts := ConvertOptions{Method: CIE2000, MaxScreenColors: 4, TemporalTolerance: 50}
+	converter := Converter{Options: opts}
+	if _, err := converter.ConvertFrame(first); err != nil {
+		t.Fatal(err)
+	}
+	got, err := converter.ConvertFrame(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := Convert(second, opts)
+	if !bytes.Equal(got.Pix, want.Pix) {
+		t.Errorf("frame with MaxScreenColors differs from Convert")
+	}
+	colors := make(map[color.RGBA]bool)
+	for y := 0; y < got.Rect.Dy(); y++ {
+		for x := 0; x < got.Rect.Dx(); x++ {
+			colors[got.RGBAAt(x, y)] = true
+		}
+	}
+	if len(colors) > 4 {
+		t.Errorf("frame uses %d colors", len(colors))
+	}
+}
@@ -0,0 +1,96 @@
+package c64image
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var InvalidIndexMapError = fmt.Errorf("invalid index map")
+
+// ConvertIndices converts img like Convert but returns the palette index of
+// every block instead of an image, row by row, together with the number of
+// blocks per row. Blocks are twice as wide as high, see Convert.
+func ConvertIndices(img *image.RGBA, opts ConvertOptions) ([]uint8, int, error) {
+	grid, indices, err := convertBlocks(img, opts, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	return indices, grid.width, nil
+}
+
+// SaveIndexMap saves indices as a grayscale PNG with one pixel per index.
+// Every pixel is index*0x11, so the low nibble is the palette index and the
+// map stays viewable. The palette is written next to it with the extension
+// .pal, one RRGGBB hex line per index of C64Colors.
+func SaveIndexMap(indices []uint8, width int, filename string) error {
+	if width <= 0 || len(indices)%width != 0 {
+		return fmt.Errorf("%w: %d indices do not fill rows of %d", InvalidIndexMapError, len(indices), width)
+	}
+	img := image.NewGray(image.Rect(0, 0, width, len(indices)/width))
+	for i, index := range indices {
+		if int(index) >= len(C64Colors) {
+			return fmt.Errorf("%w: palette index %d", InvalidIndexMapError, index)
+		}
+		img.Pix[i] = index * 0x11
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := png.Encode(file, img); err != nil {
+		return err
+	}
+
+	var palette strings.Builder
+	for _, c := range C64Colors {
+		fmt.Fprintf(&palette, "%02X%02X%02X\n", c.R, c.G, c.B)
+	}
+	paletteFilename := strings.TrimSuffix(filename, filepath.Ext(filename)) + ".pal"
+	return ioutil.WriteFile(paletteFilename, []byte(palette.String()), 0644)
+}
+
+// MethodAgreementMap converts img with methods a and b and returns an image
+// of the same size as Convert's that is black where both chose the same
+// palette color and white where they differ.
+func MethodAgreementMap(img *image.RGBA, a, b Method) (*image.RGBA, error) {
+	first, width, err := ConvertIndices(img, ConvertOptions{Method: a})
+	if err != nil {
+		return nil, err
+	}
+	second, _, err := ConvertIndices(img, ConvertOptions{Method: b})
+	if err != nil {
+		return nil, err
+	}
+	_, mask := DiffIndices(first, second)
+	agreement := make([]uint8, len(mask))
+	for i, differs := range mask {
+		if differs {
+			agreement[i] = 1 // white
+		}
+	}
+	return renderIndices(agreement, width, len(agreement)/width), nil
+}
+
+// DiffIndices compares two index maps of the same size, such as results of
+// ConvertIndices with different options, and returns how many entries differ
+// and which ones.
+func DiffIndices(a, b []uint8) (changed int, mask []bool) {
+	if len(a) != len(b) {
+		panic(fmt.Sprintf("DiffIndices: index maps of length %d and %d", len(a), len(b)))
+	}
+	mask = make([]bool, len(a))
+	for i := range a {
+		if a[i] != b[i] {
+			mask[i] = true
+			changed++
+		}
+	}
+	return changed, mask
+}
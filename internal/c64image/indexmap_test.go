@@ -0,0 +1,107 @@
+package c64image
+
+import (
+	"bufio"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveIndexMap(t *testing.T) {
+	indices, width, err := ConvertIndices(gradientImage(640, 400), ConvertOptions{Method: CIE2000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "map.png")
+	if err := SaveIndexMap(indices, width, filename); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	img, err := png.Decode(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := img.Bounds().Size(); size != image.Pt(width, len(indices)/width) {
+		t.Fatalf("index map is %v", size)
+	}
+	for i, index := range indices {
+		r, _, _, _ := img.At(i%width, i/width).RGBA()
+		if got := uint8(r>>8) & 0x0F; got != index {
+			t.Fatalf("pixel %v has index %v, want %v", i, got, index)
+		}
+	}
+
+	palette, err := os.Open(filepath.Join(dir, "map.pal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer palette.Close()
+	lines := 0
+	for scanner := bufio.NewScanner(palette); scanner.Scan(); lines++ {
+	}
+	if lines != len(C64Colors) {
+		t.Errorf("palette has %v lines", lines)
+	}
+
+	if err := SaveIndexMap([]uint8{16}, 1, filename); err == nil {
+		t.Errorf("expected error for index outside the palette")
+	}
+}
+
+func TestDiffIndices(t *testing.T) {
+	a, _, err := ConvertIndices(gradientImage(640, 400), ConvertOptions{Method: CIE2000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := append([]uint8(nil), a...)
+	if changed, _ := DiffIndices(a, b); changed != 0 {
+		t.Errorf("identical maps: %d changes", changed)
+	}
+
+	b[1234] = (b[1234] + 1) % 16
+	changed, mask := DiffIndices(a, b)
+	if changed != 1 || !mask[1234] {
+		t.Errorf("one edit: %d changes, mask at edit %v", changed, mask[1234])
+	}
+}
+
+func TestMethodAgreementMap(t *testing.T) {
+	// Share of white pixels, where RGB and CIE2000 disagree.
+	disagreement := func(img *image.RGBA) float64 {
+		agreement, err := MethodAgreementMap(img, RGBMethod, CIE2000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		white := 0
+		for i := 0; i < len(agreement.Pix); i += 4 {
+			if agreement.Pix[i] == 0xFF {
+				white++
+			}
+		}
+		return float64(white) / float64(len(agreement.Pix)/4)
+	}
+
+	gray := image.NewRGBA(image.Rect(0, 0, 640, 400))
+	for y := 0; y < 400; y++ {
+		for x := 0; x < 640; x++ {
+			v := uint8(x * 255 / 640)
+			gray.SetRGBA(x, y, color.RGBA{v, v, v, 0xFF})
+		}
+	}
+	grayShare, saturatedShare := disagreement(gray), disagreement(gradientImage(640, 400))
+	if grayShare > .5 {
+		t.Errorf("methods disagree on %v of a grayscale image", grayShare)
+	}
+	if saturatedShare <= grayShare {
+		t.Errorf("methods disagree on %v of a colorful image, %v of a grayscale one", saturatedShare, grayShare)
+	}
+}
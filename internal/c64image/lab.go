@@ -0,0 +1,40 @@
+package c64image
+
+import (
+	"image/color"
+	"math"
+)
+
+// Lab is a CIELAB color using illuminant D65.
+type Lab struct {
+	L, A, B float64
+}
+
+func RGBAToLab(c color.RGBA) Lab {
+	lab := convertRGBAtoCIELAB(c)
+	return Lab{lab.l, lab.a, lab.b}
+}
+
+// LabToRGBA converts c back to sRGB, clamping colors outside of the gamut.
+func LabToRGBA(c Lab) color.RGBA {
+	return convertCIELABtoRGBA(c.cielab())
+}
+
+func (c Lab) cielab() cielab {
+	return cielab{c.L, c.A, c.B}
+}
+
+// The matching code compares squared distances to avoid square roots. The
+// exported functions return the actual delta-E.
+
+func DeltaE76(c1, c2 Lab) float64 {
+	return math.Sqrt(cie76distance(c1.cielab(), c2.cielab()))
+}
+
+func DeltaE94(c1, c2 Lab) float64 {
+	return math.Sqrt(cie94distance(c1.cielab(), c2.cielab()))
+}
+
+func DeltaE2000(c1, c2 Lab) float64 {
+	return math.Sqrt(cie2000distance(c1.cielab(), c2.cielab()))
+}
@@ -0,0 +1,98 @@
+package c64image
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestDeltaE(t *testing.T) {
+	// CIE2000 pairs are from Sharma, Wu and Dalal, "The CIEDE2000
+	// color-difference formula: Implementation notes, supplementary test
+	// data, and mathematical observations".
+	tests := []struct {
+		name     string
+		deltaE   func(Lab, Lab) float64
+		c1, c2   Lab
+		expected float64
+	}{
+		{"DeltaE76", DeltaE76, Lab{50, 0, 0}, Lab{50, 3, 4}, 5},
+		{"DeltaE94", DeltaE94, Lab{50, 0, 0}, Lab{53, 0, 0}, 3},
+		{"DeltaE2000", DeltaE2000, Lab{50, 0, 0}, Lab{50, -1, 2}, 2.3669},
+		{"DeltaE2000", DeltaE2000, Lab{50, 2.6772, -79.7751}, Lab{50, 0, -82.7485}, 2.0425},
+		{"DeltaE2000", DeltaE2000, Lab{50, 2.5, 0}, Lab{73, 25, -18}, 27.1492},
+		{"DeltaE2000", DeltaE2000, Lab{60.2574, -34.0099, 36.2677}, Lab{60.4626, -34.1751, 39.4387}, 1.2644},
+	}
+	for _, test := range tests {
+		d := test.deltaE(test.c1, test.c2)
+		if math.Abs(d-test.expected) > 1e-4 {
+			t.Errorf("%v(%v, %v) = %v, expected %v", test.name, test.c1, test.c2, d, test.expected)
+		}
+	}
+}
+
+func TestConvertWithScore(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 640, 400))
+	fillImage(img, img.Rect, C64Colors[5])
+	_, score, err := ConvertWithScore(img, ConvertOptions{Method: CIE2000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if score > 1e-6 {
+		t.Errorf("expected zero score for a palette color, got %v", score)
+	}
+
+	_, score, err = ConvertWithScore(gradientImage(640, 400), ConvertOptions{Method: CIE2000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if score <= 0 || score > 50 {
+		t.Errorf("unexpected score %v for a gradient", score)
+	}
+}
+
+func TestLabToRGBARoundTrip(t *testing.T) {
+	for r := 0; r < 256; r += 15 {
+		for g := 0; g < 256; g += 15 {
+			for b := 0; b < 256; b += 15 {
+				c := color.RGBA{uint8(r), uint8(g), uint8(b), 255}
+				if back := LabToRGBA(RGBAToLab(c)); back != c {
+					t.Errorf("%v became %v", c, back)
+				}
+			}
+		}
+	}
+
+	// Out of gamut colors are clamped.
+	if c := LabToRGBA(Lab{120, 0, 0}); c != (color.RGBA{255, 255, 255, 255}) {
+		t.Errorf("too light color gave %v", c)
+	}
+	if c := LabToRGBA(Lab{50, 0, -200}); c.R != 0 || c.B != 255 {
+		t.Errorf("too saturated blue gave %v", c)
+	}
+}
+
+func TestNearBlackLab(t *testing.T) {
+	// Reference values from the CIE formulas with exact sRGB linearization:
+	// RGB 1 is linear (1/255)/12.92, and near black L* = 903.3*Y and a*, b*
+	// are 3893.5 and 1557.4 times the differences of X/Xn, Y and Z/Zn.
+	tests := []struct {
+		c        color.RGBA
+		expected Lab
+	}{
+		{color.RGBA{0, 0, 0, 255}, Lab{0, 0, 0}},
+		{color.RGBA{1, 1, 1, 255}, Lab{.27417, 0, 0}},
+		{color.RGBA{2, 2, 2, 255}, Lab{.54834, 0, 0}},
+		{color.RGBA{1, 0, 0, 255}, Lab{.05831, .26150, .09214}},
+	}
+	for _, test := range tests {
+		lab := RGBAToLab(test.c)
+		if math.Abs(lab.L-test.expected.L) > 1e-4 || math.Abs(lab.A-test.expected.A) > 1e-4 || math.Abs(lab.B-test.expected.B) > 1e-4 {
+			t.Errorf("%v gave %v, expected %v", test.c, lab, test.expected)
+		}
+		if back := LabToRGBA(lab); back != test.c {
+			t.Errorf("%v came back as %v", test.c, back)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package c64image
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+)
+
+// DownscaleFilter selects how the source is reduced to the logical grid.
+type DownscaleFilter int
+
+const (
+	// Box averages the source pixels covered by every block.
+	Box DownscaleFilter = iota
+	// Lanczos resamples the source with a three-lobed Lanczos filter,
+	// which keeps edges and fine detail sharper than a box on photographs.
+	Lanczos
+)
+
+func (f DownscaleFilter) String() string {
+	switch f {
+	case Box:
+		return "Box"
+	case Lanczos:
+		return "Lanczos"
+	}
+	return fmt.Sprintf("DownscaleFilter(%d)", int(f))
+}
+
+// ParseDownscaleFilter returns the filter whose String matches name,
+// ignoring case.
+func ParseDownscaleFilter(name string) (DownscaleFilter, error) {
+	for f := Box; f <= Lanczos; f++ {
+		if strings.EqualFold(f.String(), name) {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown downscale filter %q", name)
+}
+
+const lanczosLobes = 3.
+
+func lanczosKernel(x float64) float64 {
+	switch {
+	case x == 0:
+		return 1.
+	case math.Abs(x) >= lanczosLobes:
+		return 0.
+	}
+	px := math.Pi * x
+	return lanczosLobes * math.Sin(px) * math.Sin(px/lanczosLobes) / (px * px)
+}
+
+// Source pixels contributing to one target pixel and their normalized
+// weights.
+type lanczosTaps struct {
+	first   int
+	weights []float64
+}
+
+// Taps of every target pixel when resampling size source pixels to count.
+// When reducing, the kernel is stretched to the width of a target pixel.
+func lanczosWeights(size, count int) []lanczosTaps {
+	scale := float64(size) / float64(count)
+	support := lanczosLobes * math.Max(scale, 1.)
+	taps := make([]lanczosTaps, count)
+	for i := range taps {
+		center := (float64(i) + .5) * scale
+		first := int(math.Max(0., math.Floor(center-support)))
+		last := int(math.Min(float64(size-1), math.Ceil(center+support)))
+		weights := make([]float64, last-first+1)
+		total := 0.
+		for p := first; p <= last; p++ {
+			w := lanczosKernel((float64(p) + .5 - center) / math.Max(scale, 1.))
+			weights[p-first] = w
+			total += w
+		}
+		for k := range weights {
+			weights[k] /= total
+		}
+		taps[i] = lanczosTaps{first, weights}
+	}
+	return taps
+}
+
+// Fill the blocks of grid by resampling img with Lanczos, first horizontally
+// and then vertically.
+func lanczosBlocks(img *image.RGBA, grid blockGrid) {
+	size := img.Rect.Size()
+	columns := lanczosWeights(size.X, grid.width)
+	rows := lanczosWeights(size.Y, grid.height)
+
+	horizontal := make([][3]float64, grid.width*size.Y)
+	for y := 0; y < size.Y; y++ {
+		for i, taps := range columns {
+			var sum [3]float64
+			for k, w := range taps.weights {
+				c := img.RGBAAt(img.Rect.Min.X+taps.first+k, img.Rect.Min.Y+y)
+				sum[0] += w * float64(c.R)
+				sum[1] += w * float64(c.G)
+				sum[2] += w * float64(c.B)
+			}
+			horizontal[y*grid.width+i] = sum
+		}
+	}
+
+	for j, taps := range rows {
+		for i := 0; i < grid.width; i++ {
+			var sum [3]float64
+			for k, w := range taps.weights {
+				c := horizontal[(taps.first+k)*grid.width+i]
+				sum[0] += w * c[0]
+				sum[1] += w * c[1]
+				sum[2] += w * c[2]
+			}
+			rgbColor := color.RGBA{
+				uint8(math.Round(clampChannel(sum[0]))),
+				uint8(math.Round(clampChannel(sum[1]))),
+				uint8(math.Round(clampChannel(sum[2]))),
+				255,
+			}
+			lab := convertRGBAtoCIELAB(rgbColor)
+			if grid.sampling.gamut != nil {
+				if clamped := grid.sampling.gamut.clamp(lab); clamped != lab {
+					lab, rgbColor = clamped, convertCIELABtoRGBA(clamped)
+				}
+			}
+			grid.lab[j*grid.width+i], grid.rgb[j*grid.width+i] = lab, rgbColor
+		}
+	}
+}
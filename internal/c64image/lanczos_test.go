@@ -0,0 +1,47 @@
+package c64image
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestLanczosKeepsThinLines(t *testing.T) {
+	// A 2px white line on gray straddling the boundary of two 4px blocks.
+	// A box splits it in halves that each barely lift their block.
+	img := image.NewRGBA(image.Rect(0, 0, 640, 400))
+	fillImage(img, img.Rect, color.RGBA{0x40, 0x40, 0x40, 0xFF})
+	fillImage(img, image.Rect(323, 0, 325, 400), color.RGBA{0xFF, 0xFF, 0xFF, 0xFF})
+
+	peak := func(filter DownscaleFilter) float64 {
+		grid := sampleBlocks(img, sampling{filter: filter})
+		lightness := 0.
+		for i := 0; i < grid.width; i++ {
+			lightness = math.Max(lightness, grid.lab[100*grid.width+i].l)
+		}
+		return lightness
+	}
+	if box, lanczos := peak(Box), peak(Lanczos); lanczos < box+3 {
+		t.Errorf("line peaks at lightness %v with Lanczos, %v with Box", lanczos, box)
+	}
+
+	// Flat areas stay flat.
+	flat := image.NewRGBA(image.Rect(0, 0, 500, 300))
+	fillImage(flat, flat.Rect, C64Colors[5])
+	out, err := Convert(flat, ConvertOptions{DownscaleFilter: Lanczos})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < out.Rect.Dy(); y++ {
+		for x := 0; x < out.Rect.Dx(); x++ {
+			if c := out.RGBAAt(x, y); c != C64Colors[5] {
+				t.Fatalf("pixel %d,%d of a flat image is %v", x, y, c)
+			}
+		}
+	}
+
+	if _, err := Convert(img, ConvertOptions{DownscaleFilter: Lanczos, BlockOverlap: 2}); err == nil {
+		t.Errorf("Lanczos with BlockOverlap accepted")
+	}
+}
@@ -0,0 +1,60 @@
+package c64image
+
+import "image"
+
+// Copy of img with every channel stretched so that the value below which a
+// fraction clip of the pixels lie becomes 0, and the value above which the
+// same fraction lie becomes 255. Channels with a single value are kept.
+func autoLevels(img *image.RGBA, clip float64) *image.RGBA {
+	size := img.Rect.Size()
+	var histograms [3][256]int
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		row := img.Pix[img.PixOffset(img.Rect.Min.X, y):]
+		for x := 0; x < size.X; x++ {
+			for c := range histograms {
+				histograms[c][row[x*4+c]]++
+			}
+		}
+	}
+
+	skip := int(clip * float64(size.X*size.Y))
+	var lut [3][256]uint8
+	for c, histogram := range histograms {
+		low, high := 0, 255
+		for count := 0; low < 255; low++ {
+			if count += histogram[low]; count > skip {
+				break
+			}
+		}
+		for count := 0; high > 0; high-- {
+			if count += histogram[high]; count > skip {
+				break
+			}
+		}
+		for v := range lut[c] {
+			switch {
+			case high <= low:
+				lut[c][v] = uint8(v)
+			case v <= low:
+				lut[c][v] = 0
+			case v >= high:
+				lut[c][v] = 255
+			default:
+				lut[c][v] = uint8(((v-low)*255 + (high-low)/2) / (high - low))
+			}
+		}
+	}
+
+	stretched := image.NewRGBA(img.Rect)
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		src := img.Pix[img.PixOffset(img.Rect.Min.X, y):]
+		dst := stretched.Pix[stretched.PixOffset(img.Rect.Min.X, y):]
+		for x := 0; x < size.X; x++ {
+			for c := range lut {
+				dst[x*4+c] = lut[c][src[x*4+c]]
+			}
+			dst[x*4+3] = src[x*4+3]
+		}
+	}
+	return stretched
+}
@@ -0,0 +1,54 @@
+package c64image
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestAutoLevels(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 640, 400))
+	for y := 0; y < 400; y++ {
+		for x := 0; x < 640; x++ {
+			v := uint8(50 + x*100/639)
+			img.SetRGBA(x, y, color.RGBA{v, v, v, 0xFF})
+		}
+	}
+	// Outliers that clipping should ignore.
+	img.SetRGBA(0, 0, color.RGBA{0x00, 0x00, 0x00, 0xFF})
+	img.SetRGBA(1, 0, color.RGBA{0xFF, 0xFF, 0xFF, 0xFF})
+
+	lightnessRange := func(opts ConvertOptions) float64 {
+		out, err := Convert(img, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		low, high := math.Inf(1), math.Inf(-1)
+		for y := 0; y < out.Rect.Dy(); y++ {
+			for x := 0; x < out.Rect.Dx(); x++ {
+				l := convertRGBAtoCIELAB(out.RGBAAt(x, y)).l
+				low, high = math.Min(low, l), math.Max(high, l)
+			}
+		}
+		return high - low
+	}
+
+	plain := lightnessRange(ConvertOptions{Method: CIE2000})
+	leveled := lightnessRange(ConvertOptions{Method: CIE2000, AutoLevels: true, AutoLevelsClip: .01})
+	if leveled < plain+30 {
+		t.Errorf("lightness range %v with AutoLevels, %v without", leveled, plain)
+	}
+
+	stretched := autoLevels(img, .01)
+	if c := stretched.RGBAAt(639, 200); c.R != 0xFF {
+		t.Errorf("brightest regular pixel became %v, want 255", c.R)
+	}
+	if c := stretched.RGBAAt(0, 200); c.R != 0 {
+		t.Errorf("darkest regular pixel became %v, want 0", c.R)
+	}
+
+	if _, err := Convert(img, ConvertOptions{AutoLevels: true, AutoLevelsClip: .5}); err == nil {
+		t.Errorf("expected error for AutoLevelsClip of one half")
+	}
+}
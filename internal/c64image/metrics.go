@@ -0,0 +1,60 @@
+package c64image
+
+import (
+	"image"
+	"strings"
+	"time"
+)
+
+// Metrics holds the time spent in each phase of a conversion. Phases that
+// were skipped because of the options are zero.
+type Metrics struct {
+	Decode        time.Duration // loading the source file, only set by ConvertDir
+	Preprocess    time.Duration // AutoLevels
+	Sample        time.Duration // averaging source pixels into blocks
+	ScreenColors  time.Duration // choosing the MaxScreenColors subset
+	Match         time.Duration // matching or dithering blocks to the palette
+	SnapPrimaries time.Duration
+	Coherence     time.Duration
+	Brightness    time.Duration // PreserveBrightness
+	MinContrast   time.Duration
+	Render        time.Duration // drawing the index map as an image
+	Encode        time.Duration // saving the result, only set by ConvertDir
+}
+
+// ConvertWithMetrics converts like Convert and also returns how long each
+// phase took.
+func ConvertWithMetrics(img *image.RGBA, opts ConvertOptions) (*image.RGBA, Metrics, error) {
+	result, err := convertResult(img, opts)
+	if err != nil {
+		return nil, Metrics{}, err
+	}
+	return result.Image, result.Metrics, nil
+}
+
+// String lists the phases that ran, for example "sample 3ms match 40ms".
+func (m Metrics) String() string {
+	phases := []struct {
+		name     string
+		duration time.Duration
+	}{
+		{"decode", m.Decode},
+		{"preprocess", m.Preprocess},
+		{"sample", m.Sample},
+		{"screencolors", m.ScreenColors},
+		{"match", m.Match},
+		{"snap", m.SnapPrimaries},
+		{"coherence", m.Coherence},
+		{"brightness", m.Brightness},
+		{"mincontrast", m.MinContrast},
+		{"render", m.Render},
+		{"encode", m.Encode},
+	}
+	var parts []string
+	for _, phase := range phases {
+		if phase.duration > 0 {
+			parts = append(parts, phase.name+" "+phase.duration.Round(time.Microsecond).String())
+		}
+	}
+	return strings.Join(parts, " ")
+}
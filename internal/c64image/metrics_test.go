@@ -0,0 +1,37 @@
+package c64image
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConvertWithMetrics(t *testing.T) {
+	img := gradientImage(640, 400)
+	_, metrics, err := ConvertWithMetrics(img, ConvertOptions{Method: CIE2000, Coherence: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, d := range map[string]time.Duration{
+		"Sample":    metrics.Sample,
+		"Match":     metrics.Match,
+		"Coherence": metrics.Coherence,
+		"Render":    metrics.Render,
+	} {
+		if d <= 0 {
+			t.Errorf("%v: got %v, want a positive duration", name, d)
+		}
+	}
+	for name, d := range map[string]time.Duration{
+		"Decode":        metrics.Decode,
+		"Preprocess":    metrics.Preprocess,
+		"ScreenColors":  metrics.ScreenColors,
+		"SnapPrimaries": metrics.SnapPrimaries,
+		"Brightness":    metrics.Brightness,
+		"MinContrast":   metrics.MinContrast,
+		"Encode":        metrics.Encode,
+	} {
+		if d != 0 {
+			t.Errorf("%v: got %v for a skipped phase", name, d)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package c64image
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// Montage lays out imgs row by row in cols columns on a canvas of color bg,
+// with margin pixels around and between them. Every cell is as large as the
+// largest image, and smaller images are placed in the top left corner of
+// their cell. A cols below 1 puts all images in one row.
+func Montage(imgs []*image.RGBA, cols int, margin int, bg color.RGBA) *image.RGBA {
+	if len(imgs) == 0 {
+		return image.NewRGBA(image.Rectangle{})
+	}
+	if cols < 1 || cols > len(imgs) {
+		cols = len(imgs)
+	}
+	rows := (len(imgs) + cols - 1) / cols
+	var cell image.Point
+	for _, img := range imgs {
+		size := img.Rect.Size()
+		if size.X > cell.X {
+			cell.X = size.X
+		}
+		if size.Y > cell.Y {
+			cell.Y = size.Y
+		}
+	}
+
+	montage := image.NewRGBA(image.Rect(0, 0, cols*(cell.X+margin)+margin, rows*(cell.Y+margin)+margin))
+	draw.Draw(montage, montage.Rect, &image.Uniform{bg}, image.Point{}, draw.Src)
+	for i, img := range imgs {
+		at := image.Pt(margin+i%cols*(cell.X+margin), margin+i/cols*(cell.Y+margin))
+		draw.Draw(montage, img.Rect.Sub(img.Rect.Min).Add(at), img, img.Rect.Min, draw.Src)
+	}
+	return montage
+}
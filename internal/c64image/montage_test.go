@@ -0,0 +1,42 @@
+package c64image
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestMontage(t *testing.T) {
+	bg := color.RGBA{0x10, 0x20, 0x30, 0xFF}
+	var imgs []*image.RGBA
+	for i := 0; i < 5; i++ {
+		img := image.NewRGBA(image.Rect(0, 0, 320, 200))
+		fillImage(img, img.Rect, C64Colors[i+1])
+		imgs = append(imgs, img)
+	}
+
+	montage := Montage(imgs, 2, 10, bg)
+	if size := montage.Rect.Size(); size != image.Pt(2*320+3*10, 3*200+4*10) {
+		t.Fatalf("montage of 5 images in 2 columns is %v", size)
+	}
+	for i := range imgs {
+		x, y := 10+i%2*330, 10+i/2*210
+		if c := montage.RGBAAt(x, y); c != C64Colors[i+1] {
+			t.Errorf("image %d: top left at %d,%d is %v", i, x, y, c)
+		}
+		if c := montage.RGBAAt(x+319, y+199); c != C64Colors[i+1] {
+			t.Errorf("image %d: bottom right is %v", i, c)
+		}
+		if c := montage.RGBAAt(x-1, y-1); c != bg {
+			t.Errorf("image %d: margin is %v", i, c)
+		}
+	}
+	// The empty cell after the last image.
+	if c := montage.RGBAAt(10+330, 10+2*210); c != bg {
+		t.Errorf("empty cell is %v", c)
+	}
+
+	if size := Montage(imgs, 0, 0, bg).Rect.Size(); size != image.Pt(5*320, 200) {
+		t.Errorf("montage in one row is %v", size)
+	}
+}
@@ -0,0 +1,114 @@
+package c64image
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// Range in channel steps over which ordered dithering moves a color. It is
+// about the distance between neighboring grays in the palette.
+const orderedDitherSpread = 64.
+
+// ThresholdMatrix is a pattern of thresholds in [0, 1) that is tiled over the
+// image for ordered dithering.
+type ThresholdMatrix struct {
+	width  int
+	height int
+	values []float64
+}
+
+var EmptyImageError = fmt.Errorf("empty image")
+var NotGrayscaleError = fmt.Errorf("image is not grayscale")
+
+// Largest difference between the channels of a pixel still read as gray.
+const grayTolerance = 0x10
+
+// ThresholdMatrixFromImage reads a threshold matrix from a grayscale image,
+// mapping black to 0 and white to just below 1.
+func ThresholdMatrixFromImage(img image.Image) (*ThresholdMatrix, error) {
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return nil, EmptyImageError
+	}
+	m := &ThresholdMatrix{bounds.Dx(), bounds.Dy(), make([]float64, bounds.Dx()*bounds.Dy())}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+			low := math.Min(float64(c.R), math.Min(float64(c.G), float64(c.B)))
+			high := math.Max(float64(c.R), math.Max(float64(c.G), float64(c.B)))
+			if high-low > grayTolerance {
+				return nil, NotGrayscaleError
+			}
+			gray := color.GrayModel.Convert(c).(color.Gray)
+			m.values[(y-bounds.Min.Y)*m.width+x-bounds.Min.X] = (float64(gray.Y) + .5) / 256.
+		}
+	}
+	return m, nil
+}
+
+// Square matrix holding each rank from 0 to size*size-1 once.
+func rankMatrix(size int, ranks []uint8) *ThresholdMatrix {
+	m := &ThresholdMatrix{size, size, make([]float64, len(ranks))}
+	for i, rank := range ranks {
+		m.values[i] = (float64(rank) + .5) / float64(len(ranks))
+	}
+	return m
+}
+
+var bayerMatrix = rankMatrix(4, []uint8{
+	0, 8, 2, 10,
+	12, 4, 14, 6,
+	3, 11, 1, 9,
+	15, 7, 13, 5,
+})
+
+// Generated with the void-and-cluster method (Ulichney 1993) using a
+// Gaussian with sigma 1.5 on a torus.
+var blueNoiseTexture = rankMatrix(16, []uint8{
+	234, 50, 188, 19, 58, 171, 121, 47, 163, 3, 247, 104, 22, 132, 14, 65,
+	209, 8, 118, 97, 240, 205, 23, 228, 138, 64, 123, 170, 72, 224, 99, 149,
+	85, 139, 229, 165, 78, 146, 111, 84, 176, 216, 30, 231, 153, 201, 42, 180,
+	25, 62, 195, 29, 43, 185, 7, 249, 41, 100, 191, 48, 87, 5, 128, 243,
+	221, 152, 101, 253, 130, 220, 59, 200, 156, 12, 136, 112, 254, 174, 69, 109,
+	46, 189, 2, 73, 172, 90, 142, 116, 80, 237, 210, 61, 147, 33, 206, 160,
+	81, 124, 217, 113, 208, 15, 241, 27, 168, 45, 178, 20, 193, 96, 225, 18,
+	242, 164, 60, 35, 157, 53, 181, 68, 223, 105, 125, 83, 236, 131, 55, 141,
+	197, 10, 227, 134, 246, 95, 126, 198, 148, 1, 244, 161, 71, 9, 182, 106,
+	40, 93, 179, 75, 192, 6, 218, 36, 91, 57, 202, 34, 215, 155, 233, 74,
+	252, 120, 150, 24, 110, 63, 166, 119, 232, 183, 133, 103, 49, 117, 31, 167,
+	16, 212, 51, 238, 207, 137, 255, 21, 76, 151, 13, 250, 190, 88, 203, 135,
+	102, 184, 82, 169, 38, 89, 187, 52, 204, 98, 173, 67, 129, 4, 222, 56,
+	230, 144, 0, 127, 226, 11, 154, 114, 239, 39, 219, 28, 235, 145, 175, 77,
+	196, 37, 248, 70, 107, 199, 66, 177, 17, 143, 115, 159, 86, 44, 108, 26,
+	122, 92, 158, 214, 140, 32, 245, 94, 213, 79, 194, 54, 211, 186, 251, 162,
+})
+
+// Threshold at grid position x, y with the matrix tiled.
+func (m *ThresholdMatrix) at(x, y int) float64 {
+	return m.values[(y%m.height)*m.width+x%m.width]
+}
+
+// Match every block after offsetting its color by the tiled threshold.
+func orderedDither(grid blockGrid, m matcher, matrix *ThresholdMatrix) []uint8 {
+	indices := make([]uint8, len(grid.rgb))
+	for y := 0; y < grid.height; y++ {
+		for x := 0; x < grid.width; x++ {
+			indices[y*grid.width+x] = orderedIndex(grid, m, matrix, x, y)
+		}
+	}
+	return indices
+}
+
+func orderedIndex(grid blockGrid, m matcher, matrix *ThresholdMatrix, x, y int) uint8 {
+	offset := (matrix.at(x, y) - .5) * orderedDitherSpread
+	c := grid.rgb[y*grid.width+x]
+	adjusted := color.RGBA{
+		uint8(math.Round(clampChannel(float64(c.R) + offset))),
+		uint8(math.Round(clampChannel(float64(c.G) + offset))),
+		uint8(math.Round(clampChannel(float64(c.B) + offset))),
+		255,
+	}
+	return m.closest(convertRGBAtoCIELAB(adjusted), adjusted)
+}
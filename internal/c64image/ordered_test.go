@@ -0,0 +1,112 @@
+package c64image
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// Highest normalized autocorrelation of the luminance over shifts of 1 to 8
+// pixels horizontally or vertically.
+func maxAutocorrelation(indices []uint8, width, height int) float64 {
+	values := make([]float64, len(indices))
+	mean := 0.
+	for i, index := range indices {
+		values[i] = RGBAToLab(C64Colors[index]).L
+		mean += values[i]
+	}
+	mean /= float64(len(values))
+	variance := 0.
+	for i := range values {
+		values[i] -= mean
+		variance += values[i] * values[i]
+	}
+
+	highest := 0.
+	for shift := 1; shift <= 8; shift++ {
+		for _, d := range [2][2]int{{shift, 0}, {0, shift}} {
+			sum := 0.
+			for y := 0; y < height-d[1]; y++ {
+				for x := 0; x < width-d[0]; x++ {
+					sum += values[y*width+x] * values[(y+d[1])*width+x+d[0]]
+				}
+			}
+			n := float64((width - d[0]) * (height - d[1]))
+			if c := sum / n / (variance / float64(len(values))); c > highest {
+				highest = c
+			}
+		}
+	}
+	return highest
+}
+
+func TestBlueNoiseLessPeriodicThanBayer(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 640, 400))
+	fillImage(img, img.Rect, color.RGBA{128, 128, 128, 255})
+	grid := sampleBlocks(img, sampling{})
+
+	bayer := orderedDither(grid, fullMatcher(CIE2000), bayerMatrix)
+	blueNoise := orderedDither(grid, fullMatcher(CIE2000), blueNoiseTexture)
+
+	colors := make(map[uint8]bool)
+	for _, index := range blueNoise {
+		colors[index] = true
+	}
+	if len(colors) < 2 {
+		t.Fatalf("flat gray was not dithered")
+	}
+
+	bayerCorrelation := maxAutocorrelation(bayer, grid.width, grid.height)
+	blueNoiseCorrelation := maxAutocorrelation(blueNoise, grid.width, grid.height)
+	if blueNoiseCorrelation >= bayerCorrelation {
+		t.Errorf("blue noise autocorrelation %v is not below Bayer %v", blueNoiseCorrelation, bayerCorrelation)
+	}
+}
+
+func TestConstantThresholdMatrixIsBias(t *testing.T) {
+	gray := image.NewGray(image.Rect(0, 0, 1, 1))
+	gray.SetGray(0, 0, color.Gray{192})
+	matrix, err := ThresholdMatrixFromImage(gray)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Uniform 4x2 blocks, so that the block mean is exact.
+	img := image.NewRGBA(image.Rect(0, 0, 640, 400))
+	shifted := image.NewRGBA(img.Rect)
+	for y := 0; y < 400; y += 2 {
+		for x := 0; x < 640; x += 4 {
+			c := color.RGBA{uint8(x * 239 / 640), uint8(y * 239 / 400), uint8((x + y) % 240), 255}
+			fillImage(img, image.Rect(x, y, x+4, y+2), c)
+			// Threshold (192+.5)/256 moves colors by 16.125 channel steps.
+			fillImage(shifted, image.Rect(x, y, x+4, y+2), color.RGBA{c.R + 16, c.G + 16, c.B + 16, 255})
+		}
+	}
+
+	dithered, err := Convert(img, ConvertOptions{Method: RGBMethod, Dither: Ordered, ThresholdMatrix: matrix})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := Convert(shifted, ConvertOptions{Method: RGBMethod})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dithered.Pix, expected.Pix) {
+		t.Errorf("constant threshold matrix does not act as a uniform bias")
+	}
+}
+
+func TestThresholdMatrixFromImageValidates(t *testing.T) {
+	if _, err := ThresholdMatrixFromImage(image.NewGray(image.Rect(0, 0, 0, 0))); err != EmptyImageError {
+		t.Errorf("expected EmptyImageError, got %v", err)
+	}
+	colored := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	colored.SetRGBA(1, 1, color.RGBA{200, 10, 10, 255})
+	if _, err := ThresholdMatrixFromImage(colored); err != NotGrayscaleError {
+		t.Errorf("expected NotGrayscaleError, got %v", err)
+	}
+	if _, err := Convert(colored, ConvertOptions{Dither: Ordered}); err == nil {
+		t.Errorf("expected error for Ordered dither without matrix")
+	}
+}
@@ -0,0 +1,206 @@
+package c64image
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+var (
+	ColorNotInPaletteError = fmt.Errorf("color not in palette")
+	PaletteTooLargeError   = fmt.Errorf("palette has more than 256 colors")
+)
+
+// Layout of the paint by numbers sheet. Every image pixel becomes a square
+// of paintByNumbersScale pixels, large enough for a two digit label.
+const (
+	paintByNumbersScale = 8
+	legendEntryWidth    = 80
+	legendEntryHeight   = 40
+	legendSwatch        = 24
+	legendDigitScale    = 3
+)
+
+var (
+	paintByNumbersInk   = color.RGBA{0x00, 0x00, 0x00, 0xFF}
+	paintByNumbersPaper = color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}
+)
+
+// Digits of a 3x5 pixel font, one row per byte with the leftmost pixel in
+// bit 2.
+var digitGlyphs = [10][5]uint8{
+	{7, 5, 5, 5, 7}, {2, 6, 2, 2, 7}, {7, 1, 7, 4, 7}, {7, 1, 7, 1, 7}, {5, 5, 7, 1, 1},
+	{7, 4, 7, 1, 7}, {7, 4, 7, 5, 7}, {7, 1, 1, 1, 1}, {7, 5, 7, 5, 7}, {7, 5, 7, 1, 7},
+}
+
+// Label of a region of a paint by numbers sheet: the palette index to paint
+// it with, centered on pixel at of the image.
+type regionLabel struct {
+	index int
+	at    image.Point
+}
+
+// SavePaintByNumbers saves img as a paint by numbers sheet: a white
+// outline image, enlarged so that every region of one color is bordered and
+// labeled with the index of its color in palette, above a legend of the
+// used colors. Every pixel of img must have one of the at most 256 colors
+// of palette.
+func SavePaintByNumbers(img *image.RGBA, palette []color.RGBA, filename string) error {
+	sheet, _, _, err := paintByNumbers(img, palette)
+	if err != nil {
+		return err
+	}
+	return SaveImage(sheet, filename)
+}
+
+// Draw the paint by numbers sheet of img and return it together with the
+// region labels and the palette indices in the legend.
+func paintByNumbers(img *image.RGBA, palette []color.RGBA) (*image.RGBA, []regionLabel, []int, error) {
+	if len(palette) > 256 {
+		return nil, nil, nil, fmt.Errorf("%w: %d", PaletteTooLargeError, len(palette))
+	}
+	size := img.Rect.Size()
+	indices := make([]int, size.X*size.Y)
+	used := make([]bool, len(palette))
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			c := img.RGBAAt(img.Rect.Min.X+x, img.Rect.Min.Y+y)
+			index := -1
+			for i, p := range palette {
+				if p == c {
+					index = i
+					break
+				}
+			}
+			if index < 0 {
+				return nil, nil, nil, fmt.Errorf("%w: %v at %d,%d", ColorNotInPaletteError, c, x, y)
+			}
+			indices[y*size.X+x] = index
+			used[index] = true
+		}
+	}
+	var legend []int
+	for i, u := range used {
+		if u {
+			legend = append(legend, i)
+		}
+	}
+	packed := make([]uint8, len(indices))
+	for p, index := range indices {
+		packed[p] = uint8(index)
+	}
+	regions, count := labelRegions(packed, size.X, size.Y)
+	labels := placeLabels(indices, regions, count, size.X, size.Y)
+
+	perRow := size.X * paintByNumbersScale / legendEntryWidth
+	if perRow < 1 {
+		perRow = 1
+	}
+	legendRows := (len(legend) + perRow - 1) / perRow
+	width := size.X * paintByNumbersScale
+	if width < legendEntryWidth {
+		width = legendEntryWidth
+	}
+	sheet := image.NewRGBA(image.Rect(0, 0, width, size.Y*paintByNumbersScale+legendRows*legendEntryHeight))
+	fillRect(sheet, sheet.Rect, paintByNumbersPaper)
+
+	// Borders on the right and bottom edge of every pixel next to another
+	// region, and around the whole image.
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			r := regions[y*size.X+x]
+			x0, y0 := x*paintByNumbersScale, y*paintByNumbersScale
+			if x == size.X-1 || regions[y*size.X+x+1] != r {
+				fillRect(sheet, image.Rect(x0+paintByNumbersScale-1, y0, x0+paintByNumbersScale, y0+paintByNumbersScale), paintByNumbersInk)
+			}
+			if y == size.Y-1 || regions[(y+1)*size.X+x] != r {
+				fillRect(sheet, image.Rect(x0, y0+paintByNumbersScale-1, x0+paintByNumbersScale, y0+paintByNumbersScale), paintByNumbersInk)
+			}
+			if x == 0 {
+				fillRect(sheet, image.Rect(x0, y0, x0+1, y0+paintByNumbersScale), paintByNumbersInk)
+			}
+			if y == 0 {
+				fillRect(sheet, image.Rect(x0, y0, x0+paintByNumbersScale, y0+1), paintByNumbersInk)
+			}
+		}
+	}
+	for _, label := range labels {
+		center := label.at.Mul(paintByNumbersScale).Add(image.Pt(paintByNumbersScale/2, paintByNumbersScale/2))
+		drawNumber(sheet, label.index, center, 1, paintByNumbersInk)
+	}
+
+	top := size.Y * paintByNumbersScale
+	for k, index := range legend {
+		x0, y0 := k%perRow*legendEntryWidth, top+k/perRow*legendEntryHeight
+		swatch := image.Rect(x0+8, y0+(legendEntryHeight-legendSwatch)/2, x0+8+legendSwatch, y0+(legendEntryHeight+legendSwatch)/2)
+		fillRect(sheet, swatch.Inset(-1), paintByNumbersInk)
+		fillRect(sheet, swatch, palette[index])
+		drawNumber(sheet, index, image.Pt(x0+legendSwatch+30, y0+legendEntryHeight/2), legendDigitScale, paintByNumbersInk)
+	}
+	return sheet, labels, legend, nil
+}
+
+// Place one label in every region, on the pixel furthest from its border.
+func placeLabels(indices, regions []int, count, width, height int) []regionLabel {
+	// Breadth-first distance from the border pixels of every region.
+	distance := make([]int, len(regions))
+	var queue []int
+	for p := range regions {
+		x, y := p%width, p/width
+		if x == 0 || y == 0 || x == width-1 || y == height-1 ||
+			regions[p-1] != regions[p] || regions[p+1] != regions[p] ||
+			regions[p-width] != regions[p] || regions[p+width] != regions[p] {
+			queue = append(queue, p)
+		} else {
+			distance[p] = -1
+		}
+	}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		for _, q := range [4]int{p - 1, p + 1, p - width, p + width} {
+			if q >= 0 && q < len(regions) && distance[q] < 0 {
+				distance[q] = distance[p] + 1
+				queue = append(queue, q)
+			}
+		}
+	}
+
+	best := make([]int, count)
+	for r := range best {
+		best[r] = -1
+	}
+	for p, r := range regions {
+		if best[r] < 0 || distance[p] > distance[best[r]] {
+			best[r] = p
+		}
+	}
+	labels := make([]regionLabel, count)
+	for r, p := range best {
+		labels[r] = regionLabel{indices[p], image.Pt(p%width, p/width)}
+	}
+	return labels
+}
+
+// Draw n in the digit font enlarged by scale, centered on center.
+func drawNumber(img *image.RGBA, n int, center image.Point, scale int, c color.RGBA) {
+	digits := fmt.Sprint(n)
+	width := (len(digits)*4 - 1) * scale
+	x0, y0 := center.X-width/2, center.Y-5*scale/2
+	for k, d := range digits {
+		glyph := digitGlyphs[d-'0']
+		for row, bits := range glyph {
+			for column := 0; column < 3; column++ {
+				if bits&(4>>column) != 0 {
+					x, y := x0+(k*4+column)*scale, y0+row*scale
+					fillRect(img, image.Rect(x, y, x+scale, y+scale), c)
+				}
+			}
+		}
+	}
+}
+
+func fillRect(img *image.RGBA, r image.Rectangle, c color.RGBA) {
+	draw.Draw(img, r, &image.Uniform{c}, image.Point{}, draw.Src)
+}
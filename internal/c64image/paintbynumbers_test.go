@@ -0,0 +1,52 @@
+package c64image
+
+import (
+	"image"
+	"path/filepath"
+	"testing"
+)
+
+func TestPaintByNumbers(t *testing.T) {
+	// Left half blue, right half yellow.
+	img := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	fillImage(img, image.Rect(0, 0, 20, 20), C64Colors[6])
+	fillImage(img, image.Rect(20, 0, 40, 20), C64Colors[7])
+
+	sheet, labels, legend, err := paintByNumbers(img, C64Colors[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(labels) != 2 || len(legend) != 2 || legend[0] != 6 || legend[1] != 7 {
+		t.Fatalf("labels %v, legend %v", labels, legend)
+	}
+	for _, label := range labels {
+		if img.RGBAAt(label.at.X, label.at.Y) != C64Colors[label.index] {
+			t.Errorf("label %d placed on %v", label.index, img.RGBAAt(label.at.X, label.at.Y))
+		}
+		// Far from the border of its 20x20 region.
+		if label.at.Y < 5 || label.at.Y > 15 || label.at.X%20 < 5 || label.at.X%20 > 15 {
+			t.Errorf("label %d at %v", label.index, label.at)
+		}
+	}
+	// The border between the regions is drawn.
+	if c := sheet.RGBAAt(20*paintByNumbersScale-1, 10*paintByNumbersScale+3); c != paintByNumbersInk {
+		t.Errorf("border is %v", c)
+	}
+	if c := sheet.RGBAAt(10*paintByNumbersScale+1, 3*paintByNumbersScale); c != paintByNumbersPaper {
+		t.Errorf("inside of a region is %v", c)
+	}
+
+	dir := t.TempDir()
+	if err := SavePaintByNumbers(img, C64Colors[:], filepath.Join(dir, "pbn.png")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadImage(filepath.Join(dir, "pbn.png")); err != nil {
+		t.Error(err)
+	}
+	if err := SavePaintByNumbers(img, C64Colors[:6], filepath.Join(dir, "missing.png")); err == nil {
+		t.Errorf("no error for a color missing from the palette")
+	}
+	if err := SavePaintByNumbers(img, C64Colors[:], filepath.Join(dir, "missing", "pbn.png")); err == nil {
+		t.Errorf("no error for a file that can't be created")
+	}
+}
@@ -0,0 +1,91 @@
+package c64image
+
+import (
+	"image"
+	"math"
+)
+
+// Width to height ratio of the C64 screen.
+const screenAspect = float64(C64Width) / C64Height
+
+// ConvertTiles converts img like Convert, except that a source whose long
+// side is more than opts.MaxAspectRatio times its short side is split along
+// the long side into equally sized tiles of about the screen's shape, each
+// converted on its own. Tiles are returned left to right or top to bottom and
+// together cover the whole source after CropInsets and TrimBars. Other
+// sources give a single image.
+func ConvertTiles(img *image.RGBA, opts ConvertOptions) ([]*image.RGBA, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	// Insets and bars belong to the panorama, not to every tile.
+	img = opts.trimSource(img)
+	tileOpts := opts
+	tileOpts.CropInsets, tileOpts.TrimBars = nil, false
+
+	var tiles []*image.RGBA
+	for _, rect := range panoramaTiles(img.Rect, opts.MaxAspectRatio) {
+		tile, err := Convert(img.SubImage(rect).(*image.RGBA), tileOpts)
+		if err != nil {
+			return nil, err
+		}
+		tiles = append(tiles, tile)
+	}
+	return tiles, nil
+}
+
+// Whether rect is too long for maxAspect. Zero allows any shape.
+func exceedsAspect(rect image.Rectangle, maxAspect float64) bool {
+	size := rect.Size()
+	if maxAspect == 0 || size.X <= 0 || size.Y <= 0 {
+		return false
+	}
+	long, short := math.Max(float64(size.X), float64(size.Y)), math.Min(float64(size.X), float64(size.Y))
+	return long > maxAspect*short
+}
+
+// Split rect into screen shaped tiles if it exceeds maxAspect.
+func panoramaTiles(rect image.Rectangle, maxAspect float64) []image.Rectangle {
+	if !exceedsAspect(rect, maxAspect) {
+		return []image.Rectangle{rect}
+	}
+	size := rect.Size()
+	wide := float64(size.X) >= float64(size.Y)*screenAspect
+	var count int
+	if wide {
+		count = int(math.Ceil(float64(size.X) / (float64(size.Y) * screenAspect)))
+	} else {
+		count = int(math.Ceil(float64(size.Y) * screenAspect / float64(size.X)))
+	}
+
+	tiles := make([]image.Rectangle, count)
+	for k := range tiles {
+		if wide {
+			x0 := rect.Min.X + k*size.X/count
+			x1 := rect.Min.X + (k+1)*size.X/count
+			tiles[k] = image.Rect(x0, rect.Min.Y, x1, rect.Max.Y)
+		} else {
+			y0 := rect.Min.Y + k*size.Y/count
+			y1 := rect.Min.Y + (k+1)*size.Y/count
+			tiles[k] = image.Rect(rect.Min.X, y0, rect.Max.X, y1)
+		}
+	}
+	return tiles
+}
+
+// Center of img with the screen's shape if img exceeds maxAspect, otherwise
+// img itself.
+func cropToScreen(img *image.RGBA, maxAspect float64) *image.RGBA {
+	if !exceedsAspect(img.Rect, maxAspect) {
+		return img
+	}
+	size := img.Rect.Size()
+	crop := size
+	if float64(size.X) >= float64(size.Y)*screenAspect {
+		crop.X = int(math.Round(float64(size.Y) * screenAspect))
+	} else {
+		crop.Y = int(math.Round(float64(size.X) / screenAspect))
+	}
+	min := img.Rect.Min.Add(size.Sub(crop).Div(2))
+	return img.SubImage(image.Rectangle{min, min.Add(crop)}).(*image.RGBA)
+}
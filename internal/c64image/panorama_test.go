@@ -0,0 +1,73 @@
+package c64image
+
+import (
+	"bytes"
+	"image"
+	"testing"
+)
+
+func TestConvertTiles(t *testing.T) {
+	img := gradientImage(3200, 200)
+	tiles, err := ConvertTiles(img, ConvertOptions{Method: CIE2000, MaxAspectRatio: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tiles) != 10 {
+		t.Fatalf("got %d tiles, want 10", len(tiles))
+	}
+	for k, tile := range tiles {
+		if size := tile.Rect.Size(); size != image.Pt(C64Width, C64Height) {
+			t.Errorf("tile %d is %v", k, size)
+		}
+	}
+
+	covered := 0
+	for _, rect := range panoramaTiles(img.Rect, 4) {
+		covered += rect.Dx()
+	}
+	if covered != 3200 {
+		t.Errorf("tiles cover %d columns, want 3200", covered)
+	}
+
+	// A single cropped screen from Convert, the middle of the panorama.
+	cropped, err := Convert(img, ConvertOptions{Method: CIE2000, MaxAspectRatio: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := cropped.Rect.Size(); size != image.Pt(C64Width, C64Height) {
+		t.Errorf("cropped output is %v", size)
+	}
+	middle, _ := Convert(img.SubImage(image.Rect(1440, 0, 1760, 200)).(*image.RGBA), ConvertOptions{Method: CIE2000})
+	for i := range middle.Pix {
+		if middle.Pix[i] != cropped.Pix[i] {
+			t.Fatalf("cropped output is not the center of the source")
+		}
+	}
+
+	tiles, _ = ConvertTiles(gradientImage(640, 400), ConvertOptions{Method: CIE2000, MaxAspectRatio: 4})
+	if len(tiles) != 1 {
+		t.Errorf("regular image split into %d tiles", len(tiles))
+	}
+}
+
+func TestConvertTilesCropInsets(t *testing.T) {
+	img := gradientImage(3200, 200)
+	opts := ConvertOptions{Method: CIE2000, MaxAspectRatio: 2, CropInsets: &Insets{Left: 10, Right: 10}}
+	tiles, err := ConvertTiles(img, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The insets leave 2560 columns, eight screens.
+	if len(tiles) != 8 {
+		t.Fatalf("got %d tiles, want 8", len(tiles))
+	}
+	for k, tile := range tiles {
+		if size := tile.Rect.Size(); size != image.Pt(C64Width, C64Height) {
+			t.Errorf("tile %d is %v", k, size)
+		}
+	}
+	first, _ := Convert(img.SubImage(image.Rect(320, 0, 640, 200)).(*image.RGBA), ConvertOptions{Method: CIE2000})
+	if !bytes.Equal(tiles[0].Pix, first.Pix) {
+		t.Errorf("first tile does not start at the left inset")
+	}
+}
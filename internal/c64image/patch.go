@@ -0,0 +1,84 @@
+package c64image
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Unchanged gaps shorter than this are sent as part of the surrounding runs,
+// since a new run costs at least two bytes.
+const patchMinGap = 3
+
+// Patch encodes the entries of the index map next that differ from prev, for
+// example after an edit, so that ApplyPatch can recreate next from prev. The
+// patch starts with width and the number of rows as uvarints, followed by
+// runs of changed entries: the number of unchanged entries since the last
+// run, the length of the run, both uvarints, and the new entries. Patch
+// panics if prev and next differ in length or do not fill rows of width.
+func Patch(prev, next []uint8, width int) []byte {
+	if len(prev) != len(next) || width <= 0 || len(next)%width != 0 {
+		panic(fmt.Sprintf("Patch: index maps of length %d and %d in rows of %d", len(prev), len(next), width))
+	}
+	patch := appendUvarint(nil, width)
+	patch = appendUvarint(patch, len(next)/width)
+
+	end := 0 // end of the last run
+	for i := 0; i < len(next); {
+		if prev[i] == next[i] {
+			i++
+			continue
+		}
+		// Extend the run until patchMinGap unchanged entries in a row.
+		start, last := i, i
+		for i++; i < len(next) && i-last <= patchMinGap; i++ {
+			if prev[i] != next[i] {
+				last = i
+			}
+		}
+		patch = appendUvarint(patch, start-end)
+		patch = appendUvarint(patch, last+1-start)
+		patch = append(patch, next[start:last+1]...)
+		end, i = last+1, last+1
+	}
+	return patch
+}
+
+// ApplyPatch returns a copy of prev with the changes of patch, made by Patch,
+// applied. It returns nil if the patch is malformed or was made for an index
+// map of a different size.
+func ApplyPatch(prev []uint8, patch []byte) []uint8 {
+	uvarint := func() (int, bool) {
+		v, n := binary.Uvarint(patch)
+		if n <= 0 || v > uint64(len(prev)) {
+			return 0, false
+		}
+		patch = patch[n:]
+		return int(v), true
+	}
+	width, ok1 := uvarint()
+	rows, ok2 := uvarint()
+	if !ok1 || !ok2 || width*rows != len(prev) {
+		return nil
+	}
+
+	next := make([]uint8, len(prev))
+	copy(next, prev)
+	position := 0
+	for len(patch) > 0 {
+		skip, ok1 := uvarint()
+		length, ok2 := uvarint()
+		if !ok1 || !ok2 || position+skip+length > len(next) || length > len(patch) {
+			return nil
+		}
+		position += skip
+		copy(next[position:], patch[:length])
+		patch = patch[length:]
+		position += length
+	}
+	return next
+}
+
+func appendUvarint(b []byte, v int) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], uint64(v))]...)
+}
@@ -0,0 +1,41 @@
+package c64image
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPatch(t *testing.T) {
+	prev, width, err := ConvertIndices(gradientImage(640, 400), ConvertOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := make([]uint8, len(prev))
+	copy(next, prev)
+	// Paint a rectangle, a scattered dot and the very last entry.
+	for y := 50; y < 70; y++ {
+		for x := 30; x < 60; x++ {
+			next[y*width+x] = 2
+		}
+	}
+	next[120*width+7] ^= 1
+	next[len(next)-1] ^= 1
+
+	patch := Patch(prev, next, width)
+	if len(patch) > 20*(30+4)+10 {
+		t.Errorf("patch of %d bytes for %d changed entries", len(patch), 20*30+2)
+	}
+	if got := ApplyPatch(prev, patch); !bytes.Equal(got, next) {
+		t.Errorf("patched map differs from next")
+	}
+
+	if empty := Patch(prev, prev, width); !bytes.Equal(ApplyPatch(prev, empty), prev) || len(empty) > 4 {
+		t.Errorf("patch without changes is %d bytes", len(empty))
+	}
+	if got := ApplyPatch(prev[:len(prev)-width], patch); got != nil {
+		t.Errorf("patch applied to a map of a different size")
+	}
+	if got := ApplyPatch(prev, patch[:len(patch)-1]); got != nil {
+		t.Errorf("truncated patch applied")
+	}
+}
@@ -0,0 +1,43 @@
+package c64image
+
+import "image/color"
+
+// DefaultPrimaries maps the pure colors to their closest counterparts in
+// C64Colors.
+var DefaultPrimaries = map[color.RGBA]uint8{
+	{0x00, 0x00, 0x00, 0xFF}: 0,
+	{0xFF, 0xFF, 0xFF, 0xFF}: 1,
+	{0xFF, 0x00, 0x00, 0xFF}: 2,
+	{0x00, 0xFF, 0xFF, 0xFF}: 3,
+	{0xFF, 0x00, 0xFF, 0xFF}: 4,
+	{0x00, 0xFF, 0x00, 0xFF}: 5,
+	{0x00, 0x00, 0xFF, 0xFF}: 6,
+	{0xFF, 0xFF, 0x00, 0xFF}: 7,
+}
+
+// Replace index of every block that is a pure color present in mapping.
+func snapPrimaries(grid blockGrid, indices []uint8, mapping map[color.RGBA]uint8, m matcher) {
+	for p, c := range grid.rgb {
+		indices[p] = snapIndex(c, indices[p], mapping, m)
+	}
+}
+
+// Mapped index if c snaps, otherwise index.
+func snapIndex(c color.RGBA, index uint8, mapping map[color.RGBA]uint8, m matcher) uint8 {
+	if snaps(c, mapping, m) {
+		return mapping[c]
+	}
+	return index
+}
+
+// Whether c is a pure color present in mapping and the mapped index is
+// available to the matcher.
+func snaps(c color.RGBA, mapping map[color.RGBA]uint8, m matcher) bool {
+	mapped, ok := mapping[c]
+	return ok && isPrimary(c) && m.allows(mapped)
+}
+
+func isPrimary(c color.RGBA) bool {
+	extreme := func(v uint8) bool { return v == 0 || v == 0xFF }
+	return extreme(c.R) && extreme(c.G) && extreme(c.B)
+}
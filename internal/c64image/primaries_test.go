@@ -0,0 +1,39 @@
+package c64image
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestSnapPrimaries(t *testing.T) {
+	red := color.RGBA{0xFF, 0x00, 0x00, 0xFF}
+	img := image.NewRGBA(image.Rect(0, 0, 640, 400))
+	fillImage(img, img.Rect, red)
+	fillImage(img, image.Rect(320, 0, 640, 400), color.RGBA{0xFE, 0x00, 0x00, 0xFF})
+
+	mapping := map[color.RGBA]uint8{red: 10}
+	for _, method := range []Method{RGBMethod, CIE76, CIE94, CIE2000} {
+		for _, dither := range []Dither{NoDither, FloydSteinberg} {
+			out, err := Convert(img, ConvertOptions{Method: method, Dither: dither, SnapPrimaries: mapping})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c := out.RGBAAt(100, 100); c != C64Colors[10] {
+				t.Errorf("%v with dither %v: pure red became %v", method, dither, c)
+			}
+		}
+	}
+
+	// Almost pure red is matched as usual.
+	snapped, _ := Convert(img, ConvertOptions{Method: CIE2000, SnapPrimaries: mapping})
+	plain, _ := Convert(img, ConvertOptions{Method: CIE2000})
+	if snapped.RGBAAt(500, 100) != plain.RGBAAt(500, 100) {
+		t.Errorf("snapping changed a color that is not pure")
+	}
+
+	_, err := Convert(img, ConvertOptions{SnapPrimaries: map[color.RGBA]uint8{red: 16}})
+	if err == nil {
+		t.Errorf("expected error for palette index out of range")
+	}
+}
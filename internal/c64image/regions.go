@@ -0,0 +1,40 @@
+package c64image
+
+// Label 4-connected regions of equal index. Returns the region of every
+// pixel and the number of regions.
+func labelRegions(indices []uint8, width, height int) ([]int, int) {
+	labels := make([]int, len(indices))
+	for i := range labels {
+		labels[i] = -1
+	}
+
+	count := 0
+	var stack []int
+	for start := range indices {
+		if labels[start] >= 0 {
+			continue
+		}
+		labels[start] = count
+		stack = append(stack[:0], start)
+		for len(stack) > 0 {
+			p := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			x, y := p%width, p/width
+			for _, q := range [4]int{p - 1, p + 1, p - width, p + width} {
+				switch {
+				case q == p-1 && x == 0,
+					q == p+1 && x == width-1,
+					q == p-width && y == 0,
+					q == p+width && y == height-1:
+					continue
+				}
+				if labels[q] < 0 && indices[q] == indices[p] {
+					labels[q] = count
+					stack = append(stack, q)
+				}
+			}
+		}
+		count++
+	}
+	return labels, count
+}
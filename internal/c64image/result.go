@@ -0,0 +1,58 @@
+package c64image
+
+import (
+	"image"
+	"time"
+)
+
+// Result holds everything ConvertFull computes for one image.
+type Result struct {
+	// Image is the converted image, as returned by Convert.
+	Image *image.RGBA
+
+	// Indices holds the palette index of every block row by row, Width per
+	// row, as returned by ConvertIndices.
+	Indices []uint8
+	Width   int
+
+	// Method is the method the image was converted with: opts.Method, or
+	// the one chosen by ConvertAutoMethod.
+	Method Method
+
+	// Metrics holds the time spent in each phase of the conversion.
+	Metrics Metrics
+
+	// Warnings holds the advice from Warnings for the source image.
+	Warnings []string
+}
+
+// ConvertFull converts img like Convert and returns the image together with
+// the index map, timing and warnings, so that callers need not derive them
+// again.
+func ConvertFull(img *image.RGBA, opts ConvertOptions) (*Result, error) {
+	result, err := convertResult(img, opts)
+	if err != nil {
+		return nil, err
+	}
+	result.Warnings = Warnings(img)
+	return result, nil
+}
+
+// ConvertFull without Warnings, for the callers that only need part of it.
+func convertResult(img *image.RGBA, opts ConvertOptions) (*Result, error) {
+	result := &Result{Method: opts.Method}
+	grid, indices, err := convertBlocks(img, opts, &result.Metrics)
+	if err != nil {
+		return nil, err
+	}
+	result.render(grid, indices)
+	return result, nil
+}
+
+// Set the image and index map of result from indices.
+func (result *Result) render(grid blockGrid, indices []uint8) {
+	start := time.Now()
+	result.Image = renderIndices(indices, grid.width, grid.height)
+	result.Metrics.Render = time.Since(start)
+	result.Indices, result.Width = indices, grid.width
+}
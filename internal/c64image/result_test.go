@@ -0,0 +1,51 @@
+package c64image
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestConvertFull(t *testing.T) {
+	// Mostly dark and more than four times the target size.
+	img := image.NewRGBA(image.Rect(0, 0, 1600, 1000))
+	fillImage(img, img.Rect, color.RGBA{30, 20, 25, 0xFF})
+	fillImage(img, image.Rect(0, 0, 800, 1000), C64Colors[2])
+	opts := ConvertOptions{Method: CIE94, Coherence: 2}
+
+	result, err := ConvertFull(img, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := Convert(img, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(result.Image.Pix, want.Pix) || result.Image.Rect != want.Rect {
+		t.Errorf("image differs from Convert")
+	}
+	indices, width, err := ConvertIndices(img, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(result.Indices, indices) || result.Width != width || width != C64MulticolorWidth {
+		t.Errorf("index map of width %d differs from ConvertIndices", result.Width)
+	}
+	if result.Indices[0] != 2 {
+		t.Errorf("red half has index %d", result.Indices[0])
+	}
+	if result.Method != CIE94 {
+		t.Errorf("method %v", result.Method)
+	}
+	if result.Metrics.Sample <= 0 || result.Metrics.Match <= 0 || result.Metrics.Coherence <= 0 || result.Metrics.Render <= 0 {
+		t.Errorf("metrics %+v", result.Metrics)
+	}
+	if len(result.Warnings) != 2 {
+		t.Errorf("warnings %q, want a dark and an oversized source", result.Warnings)
+	}
+
+	if _, err := ConvertFull(img, ConvertOptions{Method: -1}); err == nil {
+		t.Errorf("no error for invalid options")
+	}
+}
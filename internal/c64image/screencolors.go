@@ -0,0 +1,85 @@
+package c64image
+
+import (
+	"math"
+	"sort"
+)
+
+// Pick the count entries of m that minimize the summed distance of every
+// block to its closest picked entry. Entries are added greedily and the
+// result is then improved by swapping single entries until no swap helps.
+// The returned indices are sorted so that ties resolve as with the full
+// palette.
+func selectScreenColors(grid blockGrid, m matcher, count int) []uint8 {
+	if count >= len(m.indices) {
+		return m.indices
+	}
+
+	distances := make([][]float64, len(m.indices))
+	for i := range distances {
+		distances[i] = make([]float64, len(grid.lab))
+		for p := range grid.lab {
+			distances[i][p] = m.distance(grid.lab[p], grid.rgb[p], i)
+		}
+	}
+	cost := func(chosen []int) float64 {
+		total := 0.
+		for p := range grid.lab {
+			best := math.Inf(1)
+			for _, i := range chosen {
+				best = math.Min(best, distances[i][p])
+			}
+			total += best
+		}
+		return total
+	}
+	contains := func(chosen []int, i int) bool {
+		for _, c := range chosen {
+			if c == i {
+				return true
+			}
+		}
+		return false
+	}
+
+	var chosen []int
+	for len(chosen) < count {
+		best, bestCost := -1, math.Inf(1)
+		for i := range m.indices {
+			if contains(chosen, i) {
+				continue
+			}
+			if c := cost(append(chosen, i)); c < bestCost {
+				best, bestCost = i, c
+			}
+		}
+		chosen = append(chosen, best)
+	}
+
+	current := cost(chosen)
+	for improved := true; improved; {
+		improved = false
+		for k := range chosen {
+			for i := range m.indices {
+				if contains(chosen, i) {
+					continue
+				}
+				previous := chosen[k]
+				chosen[k] = i
+				if c := cost(chosen); c < current {
+					current = c
+					improved = true
+				} else {
+					chosen[k] = previous
+				}
+			}
+		}
+	}
+
+	sort.Ints(chosen)
+	indices := make([]uint8, len(chosen))
+	for k, i := range chosen {
+		indices[k] = m.indices[i]
+	}
+	return indices
+}
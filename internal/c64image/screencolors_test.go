@@ -0,0 +1,37 @@
+package c64image
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestMaxScreenColors(t *testing.T) {
+	img := gradientImage(640, 400)
+	for _, dither := range []Dither{NoDither, FloydSteinberg, Bayer} {
+		out, err := Convert(img, ConvertOptions{Method: CIE2000, Dither: dither, MaxScreenColors: 2, MinContrast: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		used := make(map[color.RGBA]bool)
+		for y := 0; y < out.Rect.Dy(); y++ {
+			for x := 0; x < out.Rect.Dx(); x++ {
+				used[out.RGBAAt(x, y)] = true
+			}
+		}
+		if len(used) != 2 {
+			t.Errorf("dither %v: used %d colors, want 2", dither, len(used))
+		}
+	}
+
+	full, _ := Convert(img, ConvertOptions{Method: CIE2000})
+	all, _ := Convert(img, ConvertOptions{Method: CIE2000, MaxScreenColors: 16})
+	for i := range full.Pix {
+		if full.Pix[i] != all.Pix[i] {
+			t.Fatalf("MaxScreenColors 16 differs from the full palette")
+		}
+	}
+
+	if _, err := Convert(img, ConvertOptions{MaxScreenColors: 17}); err == nil {
+		t.Errorf("expected error for MaxScreenColors above palette size")
+	}
+}
@@ -0,0 +1,95 @@
+package c64image
+
+import (
+	"math"
+	"sort"
+)
+
+// Matchers with at least this many entries, such as the mixes of
+// ExtendedPalette, search them in order of a key instead of scanning all.
+// For the 16 colors of the C64 a scan is faster.
+const sortedMatchEntries = 64
+
+// Bounds are compared with a little slack so that rounding never prunes an
+// entry whose distance equals the best one.
+const pruneSlack = 1. - 1e-9
+
+// Largest CIE2000 lightness weighting S_L for lightness in [0, 100].
+var cie2000MaxSL = 1. + .015*2500./math.Sqrt(20.+2500.)
+
+// Entries of a matcher sorted by a key that bounds their distance: green
+// for RGB, J' for CAM16UCS and L for the CIELAB methods. The distance to an
+// entry is at least a method-dependent scale times the squared difference of
+// the keys.
+type sortedEntries struct {
+	keys  []float64
+	order []int
+}
+
+func (m matcher) sortEntries() *sortedEntries {
+	s := &sortedEntries{keys: make([]float64, len(m.lab)), order: make([]int, len(m.lab))}
+	key := func(i int) float64 {
+		switch m.method {
+		case RGBMethod:
+			return float64(m.rgb[i].G)
+		case CAM16UCS:
+			return m.ucs[i].j
+		}
+		return m.lab[i].l
+	}
+	for i := range s.order {
+		s.order[i] = i
+	}
+	sort.SliceStable(s.order, func(a, b int) bool { return key(s.order[a]) < key(s.order[b]) })
+	for p, i := range s.order {
+		s.keys[p] = key(i)
+	}
+	return s
+}
+
+// Factor of the squared key difference in the lower bound of the distance.
+func (m matcher) keyScale() float64 {
+	switch m.method {
+	case CIE94:
+		return m.weights.l * m.weights.l
+	case CIE2000:
+		return m.weights.l * m.weights.l / (cie2000MaxSL * cie2000MaxSL)
+	}
+	return 1.
+}
+
+// Entry with the smallest distance, with ties going to the lowest entry as in
+// a full scan. Entries are visited outwards from key, and each direction stops
+// once the bound from the key difference exceeds the best distance.
+func (s *sortedEntries) closest(key, scale float64, distance func(int) float64) int {
+	up := sort.SearchFloat64s(s.keys, key)
+	down := up - 1
+	best, bestDistance := len(s.order), math.Inf(1)
+	for down >= 0 || up < len(s.keys) {
+		var p int
+		if up >= len(s.keys) || down >= 0 && key-s.keys[down] < s.keys[up]-key {
+			p = down
+		} else {
+			p = up
+		}
+		if d := key - s.keys[p]; scale*d*d*pruneSlack > bestDistance {
+			// Every further entry in this direction is even further away.
+			if p == down {
+				down = -1
+			} else {
+				up = len(s.keys)
+			}
+			continue
+		}
+		if p == down {
+			down--
+		} else {
+			up++
+		}
+		i := s.order[p]
+		if d := distance(i); d < bestDistance || d == bestDistance && i < best {
+			best, bestDistance = i, d
+		}
+	}
+	return best
+}
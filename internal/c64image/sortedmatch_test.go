@@ -0,0 +1,90 @@
+package c64image
+
+import (
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+func randomColors(r *rand.Rand, n int) []color.RGBA {
+	colors := make([]color.RGBA, n)
+	for i := range colors {
+		colors[i] = color.RGBA{uint8(r.Intn(256)), uint8(r.Intn(256)), uint8(r.Intn(256)), 0xFF}
+	}
+	return colors
+}
+
+func TestSortedMatchEqualsScan(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	palette := randomColors(r, 256)
+	// Duplicates must resolve to the lowest entry like a scan.
+	palette[200], palette[201] = palette[10], palette[10]
+	queries := append(randomColors(r, 2000), palette...)
+
+	for _, method := range []Method{RGBMethod, CIE76, CIE94, CIE2000, CAM16UCS} {
+		for _, weights := range []labWeights{{1., 1.}, {2., .5}, {.5, 2.}} {
+			m := colorMatcher(method, palette)
+			m.weights = weights
+			if m.sorted == nil {
+				t.Fatalf("%v: no sorted entries for %d colors", method, len(palette))
+			}
+			scan := m
+			scan.sorted = nil
+			for _, q := range queries {
+				lab := convertRGBAtoCIELAB(q)
+				if got, want := m.closestEntry(lab, q), scan.closestEntry(lab, q); got != want {
+					t.Fatalf("%v %v: %v matched entry %d, scan gives %d", method, weights, q, got, want)
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkClosestEntry256(b *testing.B) {
+	r := rand.New(rand.NewSource(1))
+	m := colorMatcher(CIE2000, randomColors(r, 256))
+	queries := randomColors(r, 1024)
+	labs := make([]cielab, len(queries))
+	for i, q := range queries {
+		labs[i] = convertRGBAtoCIELAB(q)
+	}
+	scan := m
+	scan.sorted = nil
+
+	for _, bench := range []struct {
+		name string
+		m    matcher
+	}{{"sorted", m}, {"scan", scan}} {
+		b.Run(bench.name, func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				i := n % len(queries)
+				bench.m.closestEntry(labs[i], queries[i])
+			}
+		})
+	}
+}
+
+func TestColorMatcherSizes(t *testing.T) {
+	// Matching itself has no palette size limit; only conversions are tied
+	// to the 16 entries of C64Colors.
+	r := rand.New(rand.NewSource(2))
+	queries := randomColors(r, 500)
+	for _, size := range []int{1, sortedMatchEntries - 1, sortedMatchEntries, 200, 1000} {
+		palette := randomColors(r, size)
+		for _, method := range []Method{RGBMethod, CIE76, CIE94, CIE2000, CAM16UCS} {
+			m := colorMatcher(method, palette)
+			for _, q := range queries {
+				lab := convertRGBAtoCIELAB(q)
+				i := m.closestEntry(lab, q)
+				if i < 0 || i >= size {
+					t.Fatalf("%v with %d colors: entry %d", method, size, i)
+				}
+				for k := range palette {
+					if m.distance(lab, q, k) < m.distance(lab, q, i) {
+						t.Fatalf("%v with %d colors: %v matched entry %d, but %d is closer", method, size, q, i, k)
+					}
+				}
+			}
+		}
+	}
+}
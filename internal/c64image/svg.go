@@ -0,0 +1,60 @@
+package c64image
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+)
+
+// Width to height ratio of a C64 pixel on a PAL screen.
+const PixelAspect = 0.9365
+
+// SaveSVG writes img to w as an SVG with one rect per horizontal run of equal
+// color. Runs are grouped in one layer per color, in order of first
+// appearance. Rect widths are scaled by PixelAspect so the SVG has the
+// proportions of a real screen.
+func SaveSVG(img *image.RGBA, w io.Writer) error {
+	size := img.Rect.Size()
+
+	type run struct {
+		x, y, length int
+	}
+	var colors []color.RGBA
+	layers := make(map[color.RGBA][]run)
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; {
+			c := img.RGBAAt(img.Rect.Min.X+x, img.Rect.Min.Y+y)
+			length := 1
+			for x+length < size.X && img.RGBAAt(img.Rect.Min.X+x+length, img.Rect.Min.Y+y) == c {
+				length++
+			}
+			if _, ok := layers[c]; !ok {
+				colors = append(colors, c)
+			}
+			layers[c] = append(layers[c], run{x, y, length})
+			x += length
+		}
+	}
+
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, `<svg xmlns="http://www.w3.org/2000/svg" width="%g" height="%d" viewBox="0 0 %g %d" shape-rendering="crispEdges">`+"\n",
+		svgLength(size.X), size.Y, svgLength(size.X), size.Y)
+	for _, c := range colors {
+		fmt.Fprintf(out, `<g fill="#%02x%02x%02x">`+"\n", c.R, c.G, c.B)
+		for _, r := range layers[c] {
+			fmt.Fprintf(out, `<rect x="%g" y="%d" width="%g" height="1"/>`+"\n",
+				svgLength(r.x), r.y, svgLength(r.length))
+		}
+		out.WriteString("</g>\n")
+	}
+	out.WriteString("</svg>\n")
+	return out.Flush()
+}
+
+// Horizontal length in SVG units, rounded to keep the file small.
+func svgLength(pixels int) float64 {
+	return math.Round(float64(pixels)*PixelAspect*1e4) / 1e4
+}
@@ -0,0 +1,73 @@
+package c64image
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"math"
+	"testing"
+)
+
+type svgDocument struct {
+	Width  float64 `xml:"width,attr"`
+	Height int     `xml:"height,attr"`
+	Layers []struct {
+		Fill  string `xml:"fill,attr"`
+		Rects []struct {
+			X      float64 `xml:"x,attr"`
+			Y      int     `xml:"y,attr"`
+			Width  float64 `xml:"width,attr"`
+			Height int     `xml:"height,attr"`
+		} `xml:"rect"`
+	} `xml:"g"`
+}
+
+func TestSaveSVG(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 8, 4))
+	fillImage(img, img.Rect, C64Colors[6])
+	fillImage(img, image.Rect(2, 1, 5, 3), C64Colors[1])
+
+	var buf bytes.Buffer
+	if err := SaveSVG(img, &buf); err != nil {
+		t.Fatal(err)
+	}
+	var doc svgDocument
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two full rows plus three runs in each of the two rows with white.
+	rects := 0
+	for _, layer := range doc.Layers {
+		rects += len(layer.Rects)
+	}
+	if rects != 8 {
+		t.Errorf("expected 8 rects, got %v", rects)
+	}
+
+	// Rasterize the rects back at the center of every pixel.
+	raster := make([]string, 8*4)
+	for _, layer := range doc.Layers {
+		for _, r := range layer.Rects {
+			for x := 0; x < 8; x++ {
+				cx := (float64(x) + .5) * PixelAspect
+				if cx >= r.X && cx < r.X+r.Width {
+					raster[r.Y*8+x] = layer.Fill
+				}
+			}
+		}
+	}
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 8; x++ {
+			c := img.RGBAAt(x, y)
+			want := fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+			if raster[y*8+x] != want {
+				t.Errorf("pixel %v,%v is %v, expected %v", x, y, raster[y*8+x], want)
+			}
+		}
+	}
+	if math.Abs(doc.Width-8*PixelAspect) > 1e-4 || doc.Height != 4 {
+		t.Errorf("unexpected size %vx%v", doc.Width, doc.Height)
+	}
+}
@@ -0,0 +1,54 @@
+package c64image
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+)
+
+// ThumbnailC64 decodes an image from r, converts it and writes it to w as a
+// paletted PNG at most maxWidth pixels wide, keeping the aspect ratio of the
+// converted image. A maxWidth outside 1 to 320 gives the full width of 320.
+// The zero ConvertOptions, RGB without dithering, is the fastest setting.
+func ThumbnailC64(r io.Reader, w io.Writer, maxWidth int, opts ConvertOptions) error {
+	decoded, _, err := image.Decode(r)
+	if err != nil {
+		return err
+	}
+	img, err := toRGBA(decoded)
+	if err != nil {
+		return err
+	}
+	indices, columns, err := ConvertIndices(img, opts)
+	if err != nil {
+		return err
+	}
+	rows := len(indices) / columns
+
+	if maxWidth <= 0 || maxWidth > C64Width {
+		maxWidth = C64Width
+	}
+	height := (rows*maxWidth + C64Width/2) / C64Width
+	if height < 1 {
+		height = 1
+	}
+	// Nearest neighbor keeps the palette, every pixel being a block.
+	thumbnail := image.NewPaletted(image.Rect(0, 0, maxWidth, height), c64Palette())
+	for y := 0; y < height; y++ {
+		row := y * rows / height
+		for x := 0; x < maxWidth; x++ {
+			thumbnail.Pix[y*thumbnail.Stride+x] = indices[row*columns+x*columns/maxWidth]
+		}
+	}
+	return png.Encode(w, thumbnail)
+}
+
+// C64Colors as a palette for paletted images.
+func c64Palette() color.Palette {
+	palette := make(color.Palette, len(C64Colors))
+	for i, c := range C64Colors {
+		palette[i] = c
+	}
+	return palette
+}
@@ -0,0 +1,45 @@
+package c64image
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestThumbnailC64(t *testing.T) {
+	var source bytes.Buffer
+	if err := jpeg.Encode(&source, gradientImage(800, 600), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, maxWidth := range []int{64, 320, 1000} {
+		var out bytes.Buffer
+		if err := ThumbnailC64(bytes.NewReader(source.Bytes()), &out, maxWidth, ConvertOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		img, err := png.Decode(&out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paletted, ok := img.(*image.Paletted)
+		if !ok {
+			t.Fatalf("maxWidth %d: decoded %T, want *image.Paletted", maxWidth, img)
+		}
+		want := maxWidth
+		if want > C64Width {
+			want = C64Width
+		}
+		if size := paletted.Rect.Size(); size.X != want || size.Y != want*3/4 {
+			t.Errorf("maxWidth %d: size %v, want %dx%d", maxWidth, size, want, want*3/4)
+		}
+		if len(paletted.Palette) != len(C64Colors) {
+			t.Errorf("maxWidth %d: %d palette entries", maxWidth, len(paletted.Palette))
+		}
+	}
+
+	if err := ThumbnailC64(bytes.NewReader([]byte("not an image")), &bytes.Buffer{}, 64, ConvertOptions{}); err == nil {
+		t.Errorf("no error for undecodable input")
+	}
+}
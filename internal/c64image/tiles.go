@@ -0,0 +1,61 @@
+package c64image
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+var (
+	InvalidTileSizeError    = fmt.Errorf("invalid tile size")
+	InvalidTilePaddingError = fmt.Errorf("invalid tile padding")
+)
+
+// ExportTiles slices a converted image into tiles of tileW x tileH pixels,
+// for example 8x8 for characters or 24x21 for sprites, and saves every tile
+// as a PNG in dir. The file name is template formatted with the column and
+// row of the tile, such as "tile_%02d_%02d.png". Tiles at the right and
+// bottom edge that extend beyond the image are padded with the default
+// background, palette color 0.
+func ExportTiles(img *image.RGBA, tileW, tileH int, dir, template string) error {
+	return ExportTilesWithBackground(img, tileW, tileH, 0, dir, template)
+}
+
+// ExportTilesWithBackground is ExportTiles padding with palette color
+// background instead, usually the BackgroundIndex the image was converted
+// with.
+func ExportTilesWithBackground(img *image.RGBA, tileW, tileH int, background uint8, dir, template string) error {
+	return exportTiles(img, tileW, tileH, background, func(column, row int) (io.WriteCloser, error) {
+		return os.Create(filepath.Join(dir, fmt.Sprintf(template, column, row)))
+	})
+}
+
+// Slice img into tiles and write each to the file create opens for it.
+func exportTiles(img *image.RGBA, tileW, tileH int, background uint8, create func(column, row int) (io.WriteCloser, error)) error {
+	if tileW <= 0 || tileH <= 0 {
+		return fmt.Errorf("%w: %dx%d", InvalidTileSizeError, tileW, tileH)
+	}
+	if int(background) >= len(C64Colors) {
+		return fmt.Errorf("%w: palette index %d", InvalidTilePaddingError, background)
+	}
+	size := img.Rect.Size()
+	for row := 0; row*tileH < size.Y; row++ {
+		for column := 0; column*tileW < size.X; column++ {
+			tile := image.NewRGBA(image.Rect(0, 0, tileW, tileH))
+			draw.Draw(tile, tile.Rect, &image.Uniform{C64Colors[background]}, image.Point{}, draw.Src)
+			from := img.Rect.Min.Add(image.Pt(column*tileW, row*tileH))
+			draw.Draw(tile, tile.Rect, img, from, draw.Src)
+			w, err := create(column, row)
+			if err != nil {
+				return err
+			}
+			if err := writePNG(w, tile); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
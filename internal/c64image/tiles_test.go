@@ -0,0 +1,85 @@
+package c64image
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Fails every write, like a full disk.
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) { return 0, fmt.Errorf("disk full") }
+func (failingWriter) Close() error                { return nil }
+
+func TestExportTiles(t *testing.T) {
+	img, err := Convert(gradientImage(640, 400), ConvertOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		tileW, tileH int
+		background   uint8
+		files        int
+	}{
+		{8, 8, 0, 40 * 25},
+		{24, 21, 0, 14 * 10},
+		{24, 21, 6, 14 * 10},
+		{320, 200, 0, 1},
+	} {
+		dir := t.TempDir()
+		var err error
+		if test.background == 0 {
+			err = ExportTiles(img, test.tileW, test.tileH, dir, "tile_%02d_%02d.png")
+		} else {
+			err = ExportTilesWithBackground(img, test.tileW, test.tileH, test.background, dir, "tile_%02d_%02d.png")
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) != test.files {
+			t.Errorf("%dx%d: %d files, want %d", test.tileW, test.tileH, len(files), test.files)
+		}
+
+		// The last tile is padded where it extends beyond the image.
+		last, err := os.Open(filepath.Join(dir, files[len(files)-1].Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tile, err := png.Decode(last)
+		last.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tile.Bounds() != image.Rect(0, 0, test.tileW, test.tileH) {
+			t.Errorf("%dx%d: last tile has bounds %v", test.tileW, test.tileH, tile.Bounds())
+		}
+		if x, y := 320%test.tileW, 200%test.tileH; x > 0 && y > 0 {
+			if c := tile.At(test.tileW-1, test.tileH-1); c != C64Colors[test.background] {
+				t.Errorf("%dx%d: padding is %v, want color %d", test.tileW, test.tileH, c, test.background)
+			}
+		}
+	}
+
+	dir := t.TempDir()
+	if err := ExportTiles(img, 0, 8, dir, "%d_%d.png"); err == nil {
+		t.Errorf("no error for zero tile width")
+	}
+	if err := ExportTilesWithBackground(img, 8, 8, 16, dir, "%d_%d.png"); err == nil {
+		t.Errorf("no error for padding outside the palette")
+	}
+	failing := func(column, row int) (io.WriteCloser, error) { return failingWriter{}, nil }
+	if err := exportTiles(img, 8, 8, 0, failing); err == nil {
+		t.Errorf("no error for a failed write")
+	}
+}
@@ -0,0 +1,83 @@
+package c64image
+
+import (
+	"image"
+	"math"
+)
+
+// Insets are percentages of the source size removed from each edge.
+type Insets struct {
+	Top    float64 `json:"top"`
+	Right  float64 `json:"right"`
+	Bottom float64 `json:"bottom"`
+	Left   float64 `json:"left"`
+}
+
+// Largest channel value of bar pixels when ConvertOptions.TrimTolerance is
+// zero.
+const defaultTrimTolerance = 16
+
+// Part of img that is converted after CropInsets, TrimBars and
+// MaxAspectRatio.
+func (opts ConvertOptions) cropSource(img *image.RGBA) *image.RGBA {
+	return cropToScreen(opts.trimSource(img), opts.MaxAspectRatio)
+}
+
+// Part of img left by CropInsets and TrimBars.
+func (opts ConvertOptions) trimSource(img *image.RGBA) *image.RGBA {
+	if opts.CropInsets != nil && *opts.CropInsets != (Insets{}) {
+		size := img.Rect.Size()
+		inset := func(percent float64, length int) int {
+			return int(math.Round(percent / 100. * float64(length)))
+		}
+		rect := image.Rect(
+			img.Rect.Min.X+inset(opts.CropInsets.Left, size.X),
+			img.Rect.Min.Y+inset(opts.CropInsets.Top, size.Y),
+			img.Rect.Max.X-inset(opts.CropInsets.Right, size.X),
+			img.Rect.Max.Y-inset(opts.CropInsets.Bottom, size.Y),
+		)
+		img = img.SubImage(rect).(*image.RGBA)
+	}
+	if opts.TrimBars {
+		tolerance := uint8(defaultTrimTolerance)
+		if opts.TrimTolerance > 0 {
+			tolerance = uint8(math.Min(opts.TrimTolerance, 255))
+		}
+		img = trimBars(img, tolerance)
+	}
+	return img
+}
+
+// img without the rows and columns at its edges where every pixel has all
+// channels at or below tolerance. An image that is dark everywhere is kept.
+func trimBars(img *image.RGBA, tolerance uint8) *image.RGBA {
+	dark := func(x0, y0, x1, y1 int) bool {
+		for y := y0; y < y1; y++ {
+			for x := x0; x < x1; x++ {
+				c := img.RGBAAt(x, y)
+				if c.R > tolerance || c.G > tolerance || c.B > tolerance {
+					return false
+				}
+			}
+		}
+		return true
+	}
+
+	r := img.Rect
+	for r.Min.Y < r.Max.Y && dark(r.Min.X, r.Min.Y, r.Max.X, r.Min.Y+1) {
+		r.Min.Y++
+	}
+	for r.Max.Y > r.Min.Y && dark(r.Min.X, r.Max.Y-1, r.Max.X, r.Max.Y) {
+		r.Max.Y--
+	}
+	for r.Min.X < r.Max.X && dark(r.Min.X, r.Min.Y, r.Min.X+1, r.Max.Y) {
+		r.Min.X++
+	}
+	for r.Max.X > r.Min.X && dark(r.Max.X-1, r.Min.Y, r.Max.X, r.Max.Y) {
+		r.Max.X--
+	}
+	if r.Empty() {
+		return img
+	}
+	return img.SubImage(r).(*image.RGBA)
+}
@@ -0,0 +1,40 @@
+package c64image
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestTrimBars(t *testing.T) {
+	picture := gradientImage(640, 400)
+	opts := ConvertOptions{Method: CIE2000}
+	want, err := Convert(picture, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Letterbox bars of 50 rows above and below, 10% of the height each.
+	barred := image.NewRGBA(image.Rect(0, 0, 640, 500))
+	fillImage(barred, barred.Rect, color.RGBA{0x08, 0x06, 0x0A, 0xFF})
+	draw.Draw(barred, image.Rect(0, 50, 640, 450), picture, image.Point{}, draw.Src)
+
+	for _, trim := range []ConvertOptions{
+		{Method: CIE2000, TrimBars: true},
+		{Method: CIE2000, CropInsets: &Insets{Top: 10, Bottom: 10}},
+	} {
+		got, err := Convert(barred, trim)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.Pix, want.Pix) {
+			t.Errorf("%+v: output differs from the image without bars", trim)
+		}
+	}
+
+	if _, err := Convert(barred, ConvertOptions{CropInsets: &Insets{Left: 60, Right: 40}}); err == nil {
+		t.Errorf("expected error for insets covering the whole width")
+	}
+}
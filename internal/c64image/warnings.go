@@ -0,0 +1,93 @@
+package c64image
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+// Thresholds for Warnings. Lightness is CIELAB L, chroma is sqrt(a²+b²).
+const (
+	darkLightness      = 25.
+	brightLightness    = 85.
+	saturatedChroma    = 60.
+	saturatedShare     = .25
+	oversizedSource    = 4
+	warningSampleLimit = 1 << 16
+)
+
+// Hue angles in CIELAB used to name the dominant saturated color.
+var warningHues = []struct {
+	name  string
+	angle float64
+}{
+	{"red", 40.},
+	{"yellow", 95.},
+	{"green", 140.},
+	{"cyan", 200.},
+	{"blue", 290.},
+	{"magenta", 330.},
+}
+
+// Warnings returns advice about properties of img that the conversion is
+// likely to lose, such as a very dark or bright image, colors more saturated
+// than the palette can show, or a source much larger than the target. Only a
+// subsample of the pixels is inspected. A well-balanced image gives none.
+func Warnings(img *image.RGBA) []string {
+	size := img.Rect.Size()
+	if size.X <= 0 || size.Y <= 0 {
+		return nil
+	}
+	step := int(math.Ceil(math.Sqrt(float64(size.X*size.Y) / warningSampleLimit)))
+
+	lightness := 0.
+	saturated := 0
+	hueCounts := make([]int, len(warningHues))
+	samples := 0
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y += step {
+		for x := img.Rect.Min.X; x < img.Rect.Max.X; x += step {
+			lab := convertRGBAtoCIELAB(img.RGBAAt(x, y))
+			lightness += lab.l
+			if math.Hypot(lab.a, lab.b) > saturatedChroma {
+				saturated++
+				hueCounts[closestHue(cielab2hue(lab.a, lab.b))]++
+			}
+			samples++
+		}
+	}
+	lightness /= float64(samples)
+
+	var warnings []string
+	switch {
+	case lightness < darkLightness:
+		warnings = append(warnings, "image is very dark; consider brightening it")
+	case lightness > brightLightness:
+		warnings = append(warnings, "image is very bright; consider darkening it")
+	}
+	if float64(saturated) > saturatedShare*float64(samples) {
+		dominant := 0
+		for i, count := range hueCounts {
+			if count > hueCounts[dominant] {
+				dominant = i
+			}
+		}
+		warnings = append(warnings, fmt.Sprintf("highly saturated; palette can't represent %v well", warningHues[dominant].name))
+	}
+	if size.X > oversizedSource*C64Width || size.Y > oversizedSource*C64Height {
+		warnings = append(warnings, fmt.Sprintf("source %vx%v much larger than target; consider downscaling first", size.X, size.Y))
+	}
+	return warnings
+}
+
+// Index of the warningHues entry closest to hue in degrees.
+func closestHue(hue float64) int {
+	best, bestDistance := 0, math.Inf(1)
+	for i, h := range warningHues {
+		d := math.Abs(hue - h.angle)
+		d = math.Min(d, 360.-d)
+		if d < bestDistance {
+			best, bestDistance = i, d
+		}
+	}
+	return best
+}
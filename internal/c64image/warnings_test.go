@@ -0,0 +1,42 @@
+package c64image
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestWarnings(t *testing.T) {
+	dark := image.NewRGBA(image.Rect(0, 0, 640, 400))
+	fillImage(dark, dark.Rect, color.RGBA{0x10, 0x12, 0x14, 0xFF})
+	warnings := Warnings(dark)
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "dark") {
+		t.Errorf("dark image: got %q", warnings)
+	}
+
+	magenta := image.NewRGBA(image.Rect(0, 0, 640, 400))
+	fillImage(magenta, magenta.Rect, color.RGBA{0xFF, 0x00, 0xFF, 0xFF})
+	warnings = Warnings(magenta)
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "magenta") {
+		t.Errorf("magenta image: got %q", warnings)
+	}
+
+	large := image.NewRGBA(image.Rect(0, 0, 4000, 2500))
+	fillImage(large, large.Rect, color.RGBA{0x80, 0x80, 0x80, 0xFF})
+	warnings = Warnings(large)
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "larger") {
+		t.Errorf("large image: got %q", warnings)
+	}
+
+	balanced := image.NewRGBA(image.Rect(0, 0, 640, 400))
+	for y := 0; y < 400; y++ {
+		for x := 0; x < 640; x++ {
+			v := uint8(x * 255 / 640)
+			balanced.SetRGBA(x, y, color.RGBA{v, v, v/2 + uint8(y*128/400), 0xFF})
+		}
+	}
+	if warnings := Warnings(balanced); len(warnings) != 0 {
+		t.Errorf("balanced image: got %q", warnings)
+	}
+}
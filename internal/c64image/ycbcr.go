@@ -0,0 +1,46 @@
+package c64image
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// Copy a decoded image into RGBA. JPEG images are converted from YCbCr here
+// rather than by draw.Draw, whose integer approximation is off by one step in
+// some channels.
+func toRGBA(img image.Image) (*image.RGBA, error) {
+	rgba := image.NewRGBA(img.Bounds())
+	if rgba.Stride != rgba.Rect.Size().X*4 {
+		return nil, UnsupportedStrideError
+	}
+	if ycbcr, ok := img.(*image.YCbCr); ok {
+		for y := ycbcr.Rect.Min.Y; y < ycbcr.Rect.Max.Y; y++ {
+			for x := ycbcr.Rect.Min.X; x < ycbcr.Rect.Max.X; x++ {
+				c := ycbcr.COffset(x, y)
+				rgba.SetRGBA(x, y, convertYCbCrToRGBA(ycbcr.Y[ycbcr.YOffset(x, y)], ycbcr.Cb[c], ycbcr.Cr[c]))
+			}
+		}
+		return rgba, nil
+	}
+	draw.Draw(rgba, rgba.Bounds(), img, img.Bounds().Min, draw.Src)
+	return rgba, nil
+}
+
+// Full-range YCbCr as used by JFIF, ITU-R BT.601 coefficients. JPEG has no
+// limited-range variant, so Y is not rescaled from 16-235.
+func convertYCbCrToRGBA(yy, cb, cr uint8) color.RGBA {
+	y := float64(yy)
+	b := float64(cb) - 128.
+	r := float64(cr) - 128.
+	channel := func(v float64) uint8 {
+		return uint8(math.Round(math.Max(0, math.Min(255, v))))
+	}
+	return color.RGBA{
+		channel(y + 1.402*r),
+		channel(y - 0.344136*b - 0.714136*r),
+		channel(y + 1.772*b),
+		0xFF,
+	}
+}
@@ -0,0 +1,90 @@
+package c64image
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConvertYCbCrToRGBA(t *testing.T) {
+	for _, c := range C64Colors {
+		y, cb, cr := color.RGBToYCbCr(c.R, c.G, c.B)
+		got := convertYCbCrToRGBA(y, cb, cr)
+		for i, d := range []int{int(got.R) - int(c.R), int(got.G) - int(c.G), int(got.B) - int(c.B)} {
+			if d < -1 || d > 1 {
+				t.Errorf("%v: channel %d of %v differs by %d", c, i, got, d)
+			}
+		}
+	}
+}
+
+func TestLoadYCbCrJPEG(t *testing.T) {
+	dir := t.TempDir()
+	want := color.RGBA{0x6F, 0xA3, 0xB1, 0xFF}
+	src := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	fillImage(src, src.Rect, want)
+	filename := filepath.Join(dir, "solid.jpg")
+	f, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = jpeg.Encode(f, src, &jpeg.Options{Quality: 100})
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := LoadImage(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			got := img.RGBAAt(x, y)
+			for _, d := range []int{int(got.R) - int(want.R), int(got.G) - int(want.G), int(got.B) - int(want.B)} {
+				if d < -1 || d > 1 {
+					t.Fatalf("pixel %d,%d is %v, want %v", x, y, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestToRGBAYCbCrSubImage(t *testing.T) {
+	full := image.NewYCbCr(image.Rect(0, 0, 32, 32), image.YCbCrSubsampleRatio420)
+	for i := range full.Y {
+		full.Y[i] = uint8(i * 7)
+	}
+	for i := range full.Cb {
+		full.Cb[i], full.Cr[i] = uint8(i*13), uint8(255-i*5)
+	}
+	sub := full.SubImage(image.Rect(5, 3, 29, 30)).(*image.YCbCr)
+
+	got, err := toRGBA(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Rect != sub.Rect {
+		t.Fatalf("bounds %v, want %v", got.Rect, sub.Rect)
+	}
+	drawn := image.NewRGBA(sub.Rect)
+	draw.Draw(drawn, drawn.Rect, sub, sub.Rect.Min, draw.Src)
+	differs := false
+	for y := sub.Rect.Min.Y; y < sub.Rect.Max.Y; y++ {
+		for x := sub.Rect.Min.X; x < sub.Rect.Max.X; x++ {
+			c := sub.COffset(x, y)
+			want := convertYCbCrToRGBA(sub.Y[sub.YOffset(x, y)], sub.Cb[c], sub.Cr[c])
+			if got.RGBAAt(x, y) != want {
+				t.Fatalf("pixel %d,%d is %v, want %v", x, y, got.RGBAAt(x, y), want)
+			}
+			differs = differs || drawn.RGBAAt(x, y) != want
+		}
+	}
+	if !differs {
+		t.Errorf("draw.Draw agrees everywhere, the test doesn't exercise the conversion")
+	}
+}